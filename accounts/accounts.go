@@ -0,0 +1,59 @@
+package accounts
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	authApi "github.com/alterminal/auth/api"
+	auth "github.com/alterminal/auth/model"
+)
+
+type AccountProvider interface {
+	Retrieve(ctx context.Context, token string) (auth.Account, error)
+	GetAccount(ctx context.Context, namespace, id string) (auth.Account, *Error)
+	CreateAccount(ctx context.Context, request authApi.CreateAccountRequest) (auth.Account, *Error)
+	ListAccounts(ctx context.Context, namespace string) []auth.Account
+	DeleteAccount(ctx context.Context, namespace, id string) *Error
+	SetPassword(ctx context.Context, namespace, id, password string) *Error
+}
+
+// Pinger is implemented by providers that depend on a remote service.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Ping checks that the provider can reach its backing service. Providers
+// without one are always reachable.
+func Ping(ctx context.Context, provider AccountProvider) error {
+	if pinger, ok := provider.(Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// Error is returned by providers when an account operation fails. Body holds
+// the upstream response when the provider talks to a remote service.
+type Error struct {
+	StatusCode int
+	Message    string
+	Body       any
+}
+
+func NewError(statusCode int, message string) *Error {
+	return &Error{StatusCode: statusCode, Message: message}
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return http.StatusText(e.StatusCode)
+	}
+	return e.Message
+}
+
+func (e *Error) MarshalJSON() ([]byte, error) {
+	if e.Body != nil {
+		return json.Marshal(e.Body)
+	}
+	return json.Marshal(map[string]string{"error": e.Error()})
+}
@@ -0,0 +1,221 @@
+package accounts
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	auth "github.com/alterminal/auth/model"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type CacheConfig struct {
+	// Size bounds the tokens remembered. Zero leaves them unbounded.
+	Size        int
+	TTL         time.Duration
+	NegativeTTL time.Duration
+	// JwtSecret enables local verification of self-contained tokens. Tokens
+	// with a bad signature or a missing or expired exp claim are rejected
+	// without asking the provider. Tokens carrying a subject and a namespace
+	// claim and issued at most TTL ago are accepted without asking it, unless
+	// their account was invalidated since.
+	JwtSecret string
+}
+
+// Cache remembers the outcome of Retrieve per token so that the auth service
+// is not asked on every request. Password changes and deletions made through
+// the cache drop the tokens of the affected account.
+type Cache struct {
+	AccountProvider
+	config  CacheConfig
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	// invalidated holds when accounts were invalidated, for as long as
+	// tokens issued before are trusted.
+	invalidated map[string]time.Time
+}
+
+type cacheEntry struct {
+	token     string
+	account   auth.Account
+	err       error
+	expiresAt time.Time
+}
+
+func NewCache(provider AccountProvider, config CacheConfig) *Cache {
+	return &Cache{
+		AccountProvider: provider,
+		config:          config,
+		entries:         map[string]*list.Element{},
+		lru:             list.New(),
+		invalidated:     map[string]time.Time{},
+	}
+}
+
+func (c *Cache) Retrieve(ctx context.Context, token string) (auth.Account, error) {
+	expiresAt := time.Now().Add(c.config.TTL)
+	if c.config.JwtSecret != "" {
+		claims, err := c.verify(token)
+		if err != nil {
+			return auth.Account{}, err
+		}
+		if claims != nil && claims.ExpiresAt != nil && claims.ExpiresAt.Before(expiresAt) {
+			expiresAt = claims.ExpiresAt.Time
+		}
+		if account, ok := claims.account(); ok && c.trusted(account.ID, claims.IssuedAt) {
+			return account, nil
+		}
+	}
+	if entry, ok := c.get(token); ok {
+		return entry.account, entry.err
+	}
+	account, err := c.AccountProvider.Retrieve(ctx, token)
+	if err != nil {
+		// Only a rejected token is worth remembering. Outages and canceled
+		// requests say nothing about the token.
+		if !rejected(err) {
+			return account, err
+		}
+		expiresAt = time.Now().Add(c.config.NegativeTTL)
+	}
+	c.put(&cacheEntry{token: token, account: account, err: err, expiresAt: expiresAt})
+	return account, err
+}
+
+// rejected reports whether err says the token itself is not valid.
+func rejected(err error) bool {
+	var accountError *Error
+	if errors.As(err, &accountError) {
+		return accountError.StatusCode == 401
+	}
+	return errors.Is(err, ErrInvalidToken)
+}
+
+type claims struct {
+	jwt.RegisteredClaims
+	Namespace   string `json:"namespace"`
+	Email       string `json:"email"`
+	PhoneRegion string `json:"phoneRegion"`
+	PhoneNumber string `json:"phoneNumber"`
+}
+
+// account returns the account the claims describe, if they describe one.
+func (c *claims) account() (auth.Account, bool) {
+	if c == nil || c.Subject == "" || c.Namespace == "" {
+		return auth.Account{}, false
+	}
+	return auth.Account{
+		ID:          c.Subject,
+		Namespace:   c.Namespace,
+		Email:       c.Email,
+		PhoneRegion: c.PhoneRegion,
+		PhoneNumber: c.PhoneNumber,
+	}, true
+}
+
+// trusted reports whether the claims of a token of the account issued at
+// issuedAt may be taken without asking the provider: the token is at most
+// TTL old and the account was not invalidated since. Older tokens are checked
+// with the provider once per TTL, which bounds how long a token revoked on
+// another replica is accepted.
+func (c *Cache) trusted(accountId string, issuedAt *jwt.NumericDate) bool {
+	if issuedAt == nil || time.Since(issuedAt.Time) > c.config.TTL {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	invalidatedAt, ok := c.invalidated[accountId]
+	return !ok || issuedAt.After(invalidatedAt)
+}
+
+// verify checks the signature and expiry of a JWT. It returns nil claims for
+// tokens that are not JWTs, which are left to the provider.
+func (c *Cache) verify(token string) (*claims, error) {
+	claims := &claims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		return []byte(c.config.JwtSecret), nil
+	}, jwt.WithValidMethods([]string{"HS256", "HS384", "HS512"}), jwt.WithExpirationRequired())
+	if errors.Is(err, jwt.ErrTokenMalformed) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func (c *Cache) Ping(ctx context.Context) error {
+	return Ping(ctx, c.AccountProvider)
+}
+
+func (c *Cache) SetPassword(ctx context.Context, namespace, id, password string) *Error {
+	err := c.AccountProvider.SetPassword(ctx, namespace, id, password)
+	if err == nil {
+		c.Invalidate(id)
+	}
+	return err
+}
+
+func (c *Cache) DeleteAccount(ctx context.Context, namespace, id string) *Error {
+	err := c.AccountProvider.DeleteAccount(ctx, namespace, id)
+	if err == nil {
+		c.Invalidate(id)
+	}
+	return err
+}
+
+// Invalidate drops every cached token of the account and stops trusting the
+// claims of its tokens issued until now.
+func (c *Cache) Invalidate(accountId string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.invalidated[accountId] = now
+	for id, invalidatedAt := range c.invalidated {
+		// Tokens issued before are no longer trusted for their age alone.
+		if now.Sub(invalidatedAt) > c.config.TTL {
+			delete(c.invalidated, id)
+		}
+	}
+	for _, element := range c.entries {
+		if element.Value.(*cacheEntry).account.ID == accountId {
+			c.remove(element)
+		}
+	}
+}
+
+func (c *Cache) get(token string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[token]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.remove(element)
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return entry, true
+}
+
+func (c *Cache) put(entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[entry.token]; ok {
+		c.remove(element)
+	}
+	c.entries[entry.token] = c.lru.PushFront(entry)
+	for c.config.Size > 0 && c.lru.Len() > c.config.Size {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *Cache) remove(element *list.Element) {
+	c.lru.Remove(element)
+	delete(c.entries, element.Value.(*cacheEntry).token)
+}
@@ -0,0 +1,130 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	auth "github.com/alterminal/auth/model"
+	"github.com/alterminal/auth/sdk"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type countingProvider struct {
+	*Memory
+	calls int
+	err   error
+}
+
+func (p *countingProvider) Retrieve(ctx context.Context, token string) (auth.Account, error) {
+	p.calls++
+	if p.err != nil {
+		return auth.Account{}, p.err
+	}
+	return p.Memory.Retrieve(ctx, token)
+}
+
+func TestCacheNegativeCaching(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		err    error
+		cached bool
+	}{
+		{"invalid token", ErrInvalidToken, true},
+		{"unauthorized", NewError(401, "unauthorized"), true},
+		{"unauthorized by the auth service", retrieveError(&sdk.Error{StatusCode: 401, Message: "invalid token"}), true},
+		{"auth service failure", retrieveError(&sdk.Error{StatusCode: 500, Message: "internal error"}), false},
+		{"upstream failure", NewError(503, "unavailable"), false},
+		{"canceled", context.Canceled, false},
+		{"deadline exceeded", context.DeadlineExceeded, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			provider := &countingProvider{Memory: NewMemory(), err: test.err}
+			cache := NewCache(provider, CacheConfig{TTL: time.Minute, NegativeTTL: time.Minute})
+			for range 2 {
+				if _, err := cache.Retrieve(context.Background(), "token"); !errors.Is(err, test.err) {
+					t.Fatalf("err = %v, want %v", err, test.err)
+				}
+			}
+			want := 2
+			if test.cached {
+				want = 1
+			}
+			if provider.calls != want {
+				t.Errorf("provider calls = %d, want %d", provider.calls, want)
+			}
+		})
+	}
+}
+
+func TestCacheJwt(t *testing.T) {
+	secret := "secret"
+	sign := func(method jwt.SigningMethod, key any, claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	now := time.Now()
+	expiry := now.Add(time.Hour).Unix()
+	issued := now.Unix()
+	for _, test := range []struct {
+		name    string
+		token   string
+		account string
+		err     error
+		calls   int
+	}{
+		{"account claims", sign(jwt.SigningMethodHS256, []byte(secret), jwt.MapClaims{"sub": "1", "namespace": "tenant", "iat": issued, "exp": expiry}), "1", nil, 0},
+		{"no expiry", sign(jwt.SigningMethodHS256, []byte(secret), jwt.MapClaims{"sub": "1", "namespace": "tenant", "iat": issued}), "", ErrInvalidToken, 0},
+		{"issued before the ttl", sign(jwt.SigningMethodHS256, []byte(secret), jwt.MapClaims{"sub": "1", "namespace": "tenant", "iat": now.Add(-2 * time.Minute).Unix(), "exp": expiry}), "", ErrInvalidToken, 1},
+		{"no issue time", sign(jwt.SigningMethodHS256, []byte(secret), jwt.MapClaims{"sub": "1", "namespace": "tenant", "exp": expiry}), "", ErrInvalidToken, 1},
+		{"no account claims", sign(jwt.SigningMethodHS256, []byte(secret), jwt.MapClaims{"exp": expiry}), "", ErrInvalidToken, 1},
+		{"bad signature", sign(jwt.SigningMethodHS256, []byte("other"), jwt.MapClaims{"sub": "1", "namespace": "tenant"}), "", ErrInvalidToken, 0},
+		{"expired", sign(jwt.SigningMethodHS256, []byte(secret), jwt.MapClaims{"sub": "1", "namespace": "tenant", "exp": time.Now().Add(-time.Hour).Unix()}), "", ErrInvalidToken, 0},
+		{"unsigned", sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, jwt.MapClaims{"sub": "1", "namespace": "tenant"}), "", ErrInvalidToken, 0},
+		{"opaque token", "opaque", "", ErrInvalidToken, 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			provider := &countingProvider{Memory: NewMemory()}
+			cache := NewCache(provider, CacheConfig{TTL: time.Minute, NegativeTTL: time.Minute, JwtSecret: secret})
+			account, err := cache.Retrieve(context.Background(), test.token)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("err = %v, want %v", err, test.err)
+			}
+			if account.ID != test.account {
+				t.Errorf("account = %q, want %q", account.ID, test.account)
+			}
+			if provider.calls != test.calls {
+				t.Errorf("provider calls = %d, want %d", provider.calls, test.calls)
+			}
+		})
+	}
+}
+
+func TestCacheInvalidateJwt(t *testing.T) {
+	secret := "secret"
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":       "1",
+		"namespace": "tenant",
+		"iat":       time.Now().Add(-time.Second).Unix(),
+		"exp":       time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &countingProvider{Memory: NewMemory()}
+	cache := NewCache(provider, CacheConfig{TTL: time.Minute, NegativeTTL: time.Minute, JwtSecret: secret})
+	if _, err := cache.Retrieve(context.Background(), token); err != nil {
+		t.Fatal(err)
+	}
+	cache.Invalidate("1")
+	if _, err := cache.Retrieve(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("err = %v, want the provider to reject the token", err)
+	}
+	if provider.calls != 1 {
+		t.Errorf("provider calls = %d, want 1", provider.calls)
+	}
+}
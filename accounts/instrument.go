@@ -0,0 +1,87 @@
+package accounts
+
+import (
+	"context"
+	"time"
+
+	authApi "github.com/alterminal/auth/api"
+	auth "github.com/alterminal/auth/model"
+	"github.com/alterminal/member/metrics"
+	"github.com/alterminal/member/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Instrument records the latency and errors of every call to provider and
+// traces it as a child of the caller's span.
+func Instrument(provider AccountProvider) AccountProvider {
+	return &instrumented{provider: provider}
+}
+
+type instrumented struct {
+	provider AccountProvider
+}
+
+// errorOf avoids wrapping a nil *Error into a non-nil error.
+func errorOf(err *Error) error {
+	if err == nil {
+		return nil
+	}
+	return err
+}
+
+// observe starts a span for a call and returns the function that records its
+// outcome.
+func observe(ctx context.Context, method string) (context.Context, func(error)) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "auth."+method, attribute.String("auth.method", method))
+	return ctx, func(err error) {
+		metrics.ObserveAuth(method, start, err)
+		tracing.End(span, err)
+	}
+}
+
+func (i *instrumented) Ping(ctx context.Context) error {
+	return Ping(ctx, i.provider)
+}
+
+func (i *instrumented) Retrieve(ctx context.Context, token string) (auth.Account, error) {
+	ctx, done := observe(ctx, "retrieve")
+	account, err := i.provider.Retrieve(ctx, token)
+	done(err)
+	return account, err
+}
+
+func (i *instrumented) GetAccount(ctx context.Context, namespace, id string) (auth.Account, *Error) {
+	ctx, done := observe(ctx, "get_account")
+	account, err := i.provider.GetAccount(ctx, namespace, id)
+	done(errorOf(err))
+	return account, err
+}
+
+func (i *instrumented) CreateAccount(ctx context.Context, request authApi.CreateAccountRequest) (auth.Account, *Error) {
+	ctx, done := observe(ctx, "create_account")
+	account, err := i.provider.CreateAccount(ctx, request)
+	done(errorOf(err))
+	return account, err
+}
+
+func (i *instrumented) ListAccounts(ctx context.Context, namespace string) []auth.Account {
+	ctx, done := observe(ctx, "list_accounts")
+	accounts := i.provider.ListAccounts(ctx, namespace)
+	done(nil)
+	return accounts
+}
+
+func (i *instrumented) DeleteAccount(ctx context.Context, namespace, id string) *Error {
+	ctx, done := observe(ctx, "delete_account")
+	err := i.provider.DeleteAccount(ctx, namespace, id)
+	done(errorOf(err))
+	return err
+}
+
+func (i *instrumented) SetPassword(ctx context.Context, namespace, id, password string) *Error {
+	ctx, done := observe(ctx, "set_password")
+	err := i.provider.SetPassword(ctx, namespace, id, password)
+	done(errorOf(err))
+	return err
+}
@@ -0,0 +1,135 @@
+package accounts
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+
+	authApi "github.com/alterminal/auth/api"
+	auth "github.com/alterminal/auth/model"
+	"github.com/alterminal/member/model"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// Memory keeps accounts in process memory, for local development and tests.
+// Tokens are issued with IssueToken instead of a login flow.
+type Memory struct {
+	mu        sync.RWMutex
+	accounts  map[string]auth.Account
+	passwords map[string]string
+	tokens    map[string]string
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		accounts:  map[string]auth.Account{},
+		passwords: map[string]string{},
+		tokens:    map[string]string{},
+	}
+}
+
+// IssueToken returns a new token that Retrieve resolves to the account.
+func (m *Memory) IssueToken(accountId string) string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	token := hex.EncodeToString(buf)
+	m.AddToken(token, accountId)
+	return token
+}
+
+func (m *Memory) AddToken(token, accountId string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[token] = accountId
+}
+
+func (m *Memory) Retrieve(ctx context.Context, token string) (auth.Account, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	account, ok := m.accounts[m.tokens[token]]
+	if !ok {
+		return auth.Account{}, ErrInvalidToken
+	}
+	return account, nil
+}
+
+func (m *Memory) GetAccount(ctx context.Context, namespace, id string) (auth.Account, *Error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	account, ok := m.accounts[id]
+	if !ok || account.Namespace != namespace {
+		return auth.Account{}, NewError(404, "account not found")
+	}
+	return account, nil
+}
+
+func (m *Memory) CreateAccount(ctx context.Context, request authApi.CreateAccountRequest) (auth.Account, *Error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, account := range m.accounts {
+		if account.Namespace != request.Namespace {
+			continue
+		}
+		if request.Email != "" && account.Email == request.Email {
+			return auth.Account{}, NewError(409, "account already exists")
+		}
+		if request.PhoneNumber != "" && account.PhoneRegion == request.PhoneRegion && account.PhoneNumber == request.PhoneNumber {
+			return auth.Account{}, NewError(409, "account already exists")
+		}
+	}
+	account := auth.Account{
+		ID:          model.NewID(),
+		Namespace:   request.Namespace,
+		Email:       request.Email,
+		PhoneRegion: request.PhoneRegion,
+		PhoneNumber: request.PhoneNumber,
+	}
+	m.accounts[account.ID] = account
+	m.passwords[account.ID] = request.Password
+	return account, nil
+}
+
+func (m *Memory) ListAccounts(ctx context.Context, namespace string) []auth.Account {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	accounts := make([]auth.Account, 0)
+	for _, account := range m.accounts {
+		if account.Namespace == namespace {
+			accounts = append(accounts, account)
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].ID < accounts[j].ID })
+	return accounts
+}
+
+func (m *Memory) DeleteAccount(ctx context.Context, namespace, id string) *Error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	account, ok := m.accounts[id]
+	if !ok || account.Namespace != namespace {
+		return NewError(404, "account not found")
+	}
+	delete(m.accounts, id)
+	delete(m.passwords, id)
+	for token, accountId := range m.tokens {
+		if accountId == id {
+			delete(m.tokens, token)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) SetPassword(ctx context.Context, namespace, id, password string) *Error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	account, ok := m.accounts[id]
+	if !ok || account.Namespace != namespace {
+		return NewError(404, "account not found")
+	}
+	m.passwords[id] = password
+	return nil
+}
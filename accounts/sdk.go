@@ -0,0 +1,91 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	authApi "github.com/alterminal/auth/api"
+	auth "github.com/alterminal/auth/model"
+	"github.com/alterminal/auth/sdk"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Sdk provides accounts from the remote auth service.
+type Sdk struct {
+	Client sdk.Client
+}
+
+// pingClient propagates the trace of the caller to the auth service.
+var pingClient = &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+
+// Ping checks that the auth service answers HTTP requests at all.
+func (s *Sdk) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, s.Client.BaseUrl, nil)
+	if err != nil {
+		return err
+	}
+	res, err := pingClient.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 500 {
+		return fmt.Errorf("auth service answered %s", res.Status)
+	}
+	return nil
+}
+
+func sdkError(statusCode int, body any) *Error {
+	return &Error{StatusCode: statusCode, Body: body}
+}
+
+func (s *Sdk) Retrieve(ctx context.Context, token string) (auth.Account, error) {
+	account, err := s.Client.Retrieve(token)
+	return account, retrieveError(err)
+}
+
+// retrieveError gives the answers of the auth service to Retrieve the shape
+// of the other calls, so that a rejected token can be told from an outage.
+func retrieveError(err error) error {
+	var sdkErr *sdk.Error
+	if errors.As(err, &sdkErr) {
+		return sdkError(sdkErr.StatusCode, sdkErr)
+	}
+	return err
+}
+
+func (s *Sdk) GetAccount(ctx context.Context, namespace, id string) (auth.Account, *Error) {
+	account, err := s.Client.GetAccount(namespace, sdk.WithId(id))
+	if err != nil {
+		return account, sdkError(err.StatusCode, err)
+	}
+	return account, nil
+}
+
+func (s *Sdk) CreateAccount(ctx context.Context, request authApi.CreateAccountRequest) (auth.Account, *Error) {
+	account, err := s.Client.CreateAccount(request)
+	if err != nil {
+		return account, sdkError(err.StatusCode, err)
+	}
+	return account, nil
+}
+
+func (s *Sdk) ListAccounts(ctx context.Context, namespace string) []auth.Account {
+	return s.Client.ListAccounts(namespace)
+}
+
+func (s *Sdk) DeleteAccount(ctx context.Context, namespace, id string) *Error {
+	if err := s.Client.DeleteAccount(namespace, sdk.WithId(id)); err != nil {
+		return sdkError(err.StatusCode, err)
+	}
+	return nil
+}
+
+func (s *Sdk) SetPassword(ctx context.Context, namespace, id, password string) *Error {
+	if err := s.Client.SetPassword(namespace, sdk.WithId(id), password); err != nil {
+		return sdkError(err.StatusCode, err)
+	}
+	return nil
+}
@@ -1,46 +1,55 @@
 package api
 
 import (
+	"context"
 	"errors"
-	"strconv"
+	"log/slog"
+	"net/http"
+	"slices"
 	"strings"
+	"time"
 
 	authApi "github.com/alterminal/auth/api"
 	auth "github.com/alterminal/auth/model"
-	"github.com/alterminal/auth/sdk"
-	"github.com/alterminal/common/mid"
+	"github.com/alterminal/member/accounts"
+	"github.com/alterminal/member/billing"
+	"github.com/alterminal/member/events"
+	"github.com/alterminal/member/health"
+	"github.com/alterminal/member/jobs"
+	"github.com/alterminal/member/metrics"
 	"github.com/alterminal/member/model"
 	"github.com/alterminal/member/repo"
+	"github.com/alterminal/member/tracing"
+	"github.com/alterminal/member/types"
+	"github.com/alterminal/member/webhook"
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
-func GetAccount(authClient sdk.Client) func(ctx *gin.Context) {
+func GetAccount(accountProvider accounts.AccountProvider) func(ctx *gin.Context) {
 	return func(ctx *gin.Context) {
 		token := ctx.GetHeader("Authorization")
 		splited := strings.Split(token, " ")
 		if len(splited) != 2 {
 			return
 		}
-		account, err := authClient.Retrieve(splited[1])
+		account, err := accountProvider.Retrieve(ctx, splited[1])
 		if err != nil {
 			return
 		}
 		ctx.Set("account", account)
+		logWith(ctx, "account", account.ID)
 	}
 }
 
 func IsAdmin(ctx *gin.Context) {
 	accountInterface, exists := ctx.Get("account")
 	if !exists {
-		ctx.JSON(401, gin.H{"error": "unauthorized"})
-		ctx.Abort()
+		abort(ctx, ErrUnauthorized)
 		return
 	}
 	account := accountInterface.(auth.Account)
 	if account.Namespace != "admin" {
-		ctx.JSON(401, gin.H{"error": "unauthorized"})
-		ctx.Abort()
+		abort(ctx, ErrForbidden)
 		return
 	}
 }
@@ -48,152 +57,217 @@ func IsAdmin(ctx *gin.Context) {
 func IsTenant(ctx *gin.Context) {
 	accountInterface, exists := ctx.Get("account")
 	if !exists {
-		ctx.JSON(401, gin.H{"error": "unauthorized"})
-		ctx.Abort()
+		abort(ctx, ErrUnauthorized)
 		return
 	}
 	account := accountInterface.(auth.Account)
 	if account.Namespace != "tenant" {
-		ctx.JSON(401, gin.H{"error": "unauthorized"})
-		ctx.Abort()
+		abort(ctx, ErrForbidden)
 		return
 	}
 }
 
-func IsAdminOfOrganization(db *gorm.DB) func(ctx *gin.Context) {
+func IsAdminOfOrganization(repos repo.Repositories) func(ctx *gin.Context) {
 	return func(ctx *gin.Context) {
 		accountInterface, exists := ctx.Get("account")
 		if !exists {
-			ctx.JSON(401, gin.H{"error": "unauthorized"})
-			ctx.Abort()
+			abort(ctx, ErrUnauthorized)
 			return
 		}
 		account := accountInterface.(auth.Account)
 		if account.Namespace != "tenant" {
-			ctx.JSON(401, gin.H{"error": "unauthorized"})
-			ctx.Abort()
+			abort(ctx, ErrForbidden)
 			return
 		}
 		organizationId := ctx.Param("id")
 		if organizationId == "" {
 			return
 		}
-		var organization model.Organization
-		err := db.First(&organization, organizationId).Error
+		organization, err := repos.Organizations.Get(ctx, organizationId)
 		if err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				ctx.JSON(404, gin.H{"error": "organization not found"})
-				ctx.Abort()
-				return
-			}
-			ctx.JSON(404, gin.H{"error": "organization not found"})
-			ctx.Abort()
+			abort(ctx, lookupError(ctx, err, "organization"))
+			return
+		}
+		roles, err := repos.Roles.ListByAccount(ctx, account.ID)
+		if err != nil {
+			abort(ctx, internalError(ctx, err))
 			return
 		}
-		repo.AccountRoles(db, account)
-		ctx.Set("organization", organization)
-		for _, role := range repo.AccountRoles(db, account) {
+		ctx.Set("organization", *organization)
+		logWith(ctx, "organization", organization.ID)
+		for _, role := range roles {
 			if role.OrganizationID == organizationId && role.Name == "admin" {
 				return
 			}
 		}
-		ctx.JSON(401, gin.H{"error": "unauthorized"})
-		ctx.Abort()
+		abort(ctx, ErrForbidden)
 	}
 }
 
-func IsSpaceAdmin(db *gorm.DB) func(ctx *gin.Context) {
+func IsSpaceAdmin(repos repo.Repositories) func(ctx *gin.Context) {
 	return func(ctx *gin.Context) {
+		accountInterface, exists := ctx.Get("account")
+		if !exists {
+			abort(ctx, ErrUnauthorized)
+			return
+		}
 		id := ctx.Param("id")
-		var space model.Space
-		err := db.First(&space, id).Error
+		space, err := repos.Spaces.Get(ctx, id)
 		if err != nil {
-			ctx.Abort()
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				ctx.JSON(404, gin.H{"error": "space not found"})
-				return
-			}
-			ctx.JSON(500, gin.H{"error": "internal server error"})
+			abort(ctx, lookupError(ctx, err, "space"))
+			return
+		}
+		roles, err := repos.Roles.ListByAccount(ctx, accountInterface.(auth.Account).ID)
+		if err != nil {
+			abort(ctx, internalError(ctx, err))
 			return
 		}
-		roles := repo.AccountRoles(db, ctx.MustGet("account").(auth.Account))
 		for _, role := range roles {
 			if role.OrganizationID == space.OrganizationID {
-				ctx.Set("space", space)
+				ctx.Set("space", *space)
+				logWith(ctx, "organization", space.OrganizationID, "space", space.ID)
 				return
 			}
 		}
-		ctx.JSON(401, gin.H{"error": "unauthorized"})
-		ctx.Abort()
+		abort(ctx, ErrForbidden)
 	}
 }
 
-func Run(db *gorm.DB, authClient sdk.Client) {
-	router := gin.Default()
-	router.Use(mid.AccessControllAllowfunc(mid.AccessControllAllowConfig{
-		Origin:  "*",
-		Headers: "*",
-		Methods: "*",
-	}))
-	api := &Api{db: db, authClient: authClient}
-	router.Use(GetAccount(authClient))
+// Options holds what the router needs besides the API itself.
+type Options struct {
+	Health     *health.Health
+	CORS       *CORS
+	RateLimits *RateLimits
+	// TrustedProxies may set X-Forwarded-For, which then decides the client
+	// IP used for rate limits. Nil trusts no proxy.
+	TrustedProxies []string
+	Logger         *slog.Logger
+}
+
+func NewRouter(repos repo.Repositories, billing *billing.Billing, webhooks *webhook.Dispatcher, scheduler *jobs.Scheduler, accountProvider accounts.AccountProvider, options Options) *gin.Engine {
+	registerValidations()
+	health, cors, rateLimits, logger := options.Health, options.CORS, options.RateLimits, options.Logger
+	router := gin.New()
+	router.ContextWithFallback = true
+	if err := router.SetTrustedProxies(options.TrustedProxies); err != nil {
+		panic(err)
+	}
+	router.Use(RequestID, tracing.Middleware(), Logger(logger), metrics.Middleware, gin.CustomRecovery(recovery))
+	router.NoRoute(noRoute)
+	router.NoMethod(noMethod)
+	router.HandleMethodNotAllowed = true
+	api := &Api{repos: repos, billing: billing, webhooks: webhooks, scheduler: scheduler, accountProvider: accountProvider}
+	router.Use(GetAccount(accountProvider))
+	cors.Public.extraOrigins = api.organizationOrigins
+	cors.Tenant.extraOrigins = api.organizationOrigins
+	rateLimits.Public.organization = api.organizationOf
+	rateLimits.Tenant.organization = api.organizationOf
+	group := newRouteGroups(router)
+	public := group(cors.Public, rateLimits.Public)
+	tenant := group(cors.Tenant, rateLimits.Tenant)
+	admin := group(cors.Admin, rateLimits.Admin)
+
+	document, err := OpenAPI()
+	if err != nil {
+		panic(err)
+	}
+	public.GET("/openapi.json", serveOpenAPI(document))
+	router.GET("/healthz", health.Liveness)
+	router.GET("/readyz", health.Readiness)
+	router.GET("/metrics", metrics.Handler())
 
-	router.POST("/tenants", IsAdmin, api.CreateTenant)
-	router.GET("/tenants", IsAdmin, api.ListTenants)
-	router.DELETE("/tenants/:id", IsAdmin, api.DeleteTenant)
-	router.GET("/tenants/:id", IsAdmin, api.GetAccount)
-	router.PUT("/tenants/:id/password", IsAdmin, api.SetPassword)
+	admin.POST("/tenants", IsAdmin, api.CreateTenant)
+	admin.GET("/tenants", IsAdmin, api.ListTenants)
+	admin.DELETE("/tenants/:id", IsAdmin, api.DeleteTenant)
+	admin.GET("/tenants/:id", IsAdmin, api.GetAccount)
+	admin.PUT("/tenants/:id/password", IsAdmin, api.SetPassword)
 
-	router.POST("/organizations", IsAdmin, api.CreateOrganization)
+	admin.POST("/organizations", IsAdmin, api.CreateOrganization)
 	// router.DELETE("/organizations/:id", IsAdmin, api.DeleteOrganization)
-	router.GET("/organizations/all", IsAdmin, api.ListAllOrganizations)
-
-	router.DELETE("/organizations/roles/:id", IsAdmin, api.DeleteRole)
-	router.POST("/organizations/:id/roles", IsAdmin, api.CreateRole)
-	router.GET("/organizations/:id/roles", IsAdmin, api.ListRole)
-	router.POST("/organizations/roles/:id/account", IsAdmin, api.SetAccountRole)
-	router.DELETE("/organizations/roles/:id/account", IsAdmin, api.SetAccountRole)
-
-	router.GET("/organizations", IsTenant, api.ListMyOrganizations)
-	router.POST("/organizations/:id/spaces", IsAdminOfOrganization(db), api.CreateSpace)
-	router.GET("/organizations/:id/spaces", IsAdminOfOrganization(db), api.ListSpaces)
-	router.POST("/organizations/:id/consumers", IsAdminOfOrganization(db), api.CreateConsumer)
-	router.GET("/organizations/:id/consumers", IsAdminOfOrganization(db), api.ListConsumer)
-	// router.DELETE("/spaces/:id", IsSpaceAdmin(db), api.DeleteSpace)
-	router.GET("/spaces/:id/children", IsSpaceAdmin(db), api.SpaceChildren)
-	router.POST("/spaces/:id/subscriptionPlan", IsSpaceAdmin(db), api.CreateSubscriptionPlan)
-	router.GET("/spaces/:id/subscriptionPlan", IsSpaceAdmin(db), api.ListSubscriptionPlans)
-	router.POST("/subscriptionPlan/:id/subscription", api.CreateSubscription)
-	router.DELETE("/subscriptions/:id", api.CancelSubscription)
-	router.GET("/roles", IsTenant, api.ListMyRoles)
-	router.Run(":8080")
+	admin.GET("/organizations/all", IsAdmin, api.ListAllOrganizations)
+	admin.GET("/audit", IsAdmin, api.SearchAudit)
+	admin.GET("/jobs", IsAdmin, api.ListJobs)
+	admin.GET("/jobs/:id", IsAdmin, api.GetJob)
+	admin.POST("/jobs/:id/retry", IsAdmin, api.RetryJob)
+
+	admin.DELETE("/organizations/roles/:id", IsAdmin, api.DeleteRole)
+	admin.POST("/organizations/:id/roles", IsAdmin, api.CreateRole)
+	admin.GET("/organizations/:id/roles", IsAdmin, api.ListRole)
+	admin.POST("/organizations/roles/:id/account", IsAdmin, api.SetAccountRole)
+	admin.DELETE("/organizations/roles/:id/account", IsAdmin, api.SetAccountRole)
+
+	tenant.GET("/organizations", IsTenant, api.ListMyOrganizations)
+	tenant.PUT("/organizations/:id/cors", IsAdminOfOrganization(repos), api.SetAllowedOrigins)
+	tenant.GET("/organizations/:id/audit", IsAdminOfOrganization(repos), api.ListOrganizationAudit)
+	tenant.POST("/organizations/:id/webhooks", IsAdminOfOrganization(repos), api.CreateWebhook)
+	tenant.GET("/organizations/:id/webhooks", IsAdminOfOrganization(repos), api.ListWebhooks)
+	tenant.DELETE("/organizations/:id/webhooks/:webhookId", IsAdminOfOrganization(repos), api.DeleteWebhook)
+	tenant.GET("/organizations/:id/webhooks/:webhookId/deliveries", IsAdminOfOrganization(repos), api.ListWebhookDeliveries)
+	tenant.POST("/organizations/:id/webhooks/:webhookId/deliveries/:deliveryId/redeliver", IsAdminOfOrganization(repos), api.Redeliver)
+	tenant.POST("/organizations/:id/spaces", IsAdminOfOrganization(repos), api.CreateSpace)
+	tenant.GET("/organizations/:id/spaces", IsAdminOfOrganization(repos), api.ListSpaces)
+	tenant.POST("/organizations/:id/consumers", IsAdminOfOrganization(repos), api.CreateConsumer)
+	tenant.GET("/organizations/:id/consumers", IsAdminOfOrganization(repos), api.ListConsumer)
+	// router.DELETE("/spaces/:id", IsSpaceAdmin(repos), api.DeleteSpace)
+	tenant.PUT("/spaces/:id", IsSpaceAdmin(repos), api.UpdateSpace)
+	tenant.GET("/spaces/:id/children", IsSpaceAdmin(repos), api.SpaceChildren)
+	tenant.POST("/spaces/:id/subscriptionPlan", IsSpaceAdmin(repos), api.CreateSubscriptionPlan)
+	tenant.GET("/spaces/:id/subscriptionPlan", IsSpaceAdmin(repos), api.ListSubscriptionPlans)
+	tenant.GET("/spaces/:id/entitlements", IsSpaceAdmin(repos), api.ListEntitlements)
+	public.POST("/subscriptionPlan/:id/subscription", api.CreateSubscription)
+	public.DELETE("/subscriptions/:id", api.CancelSubscription)
+	tenant.GET("/roles", IsTenant, api.ListMyRoles)
+	return router
+}
+
+// Run serves router until ctx is done, then stops accepting connections and
+// waits up to shutdownTimeout for in-flight requests.
+func Run(ctx context.Context, router *gin.Engine, addr string, shutdownTimeout time.Duration) error {
+	server := &http.Server{Addr: addr, Handler: router}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
 }
 
 type Api struct {
-	db         *gorm.DB
-	authClient sdk.Client
+	repos           repo.Repositories
+	billing         *billing.Billing
+	webhooks        *webhook.Dispatcher
+	scheduler       *jobs.Scheduler
+	accountProvider accounts.AccountProvider
 }
 
 func (a *Api) SetPassword(ctx *gin.Context) {
 	id := ctx.Param("id")
-	var req authApi.SetPasswordRequest
-	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(400, gin.H{"error": "invalid request"})
+	logWith(ctx, "tenant", id)
+	var req types.SetPasswordRequest
+	if !bind(ctx, &req) {
 		return
 	}
-	err := a.authClient.SetPassword("tenant", sdk.WithId(id), req.Password)
+	err := a.accountProvider.SetPassword(ctx, "tenant", id, req.Password)
 	if err != nil {
-		ctx.JSON(err.StatusCode, err)
+		abort(ctx, accountError(ctx, err))
 		return
 	}
+	a.audit(ctx, model.AuditEntry{Action: "tenant.password", TargetType: "tenant", TargetID: id}, nil, nil)
 	ctx.Status(204)
 }
 
 func (a *Api) GetAccount(ctx *gin.Context) {
 	id := ctx.Param("id")
-	account, err := a.authClient.GetAccount("tenant", sdk.WithId(id))
+	logWith(ctx, "tenant", id)
+	account, err := a.accountProvider.GetAccount(ctx, "tenant", id)
 	if err != nil {
-		ctx.JSON(err.StatusCode, err)
+		abort(ctx, accountError(ctx, err))
 		return
 	}
 	ctx.JSON(200, account)
@@ -201,168 +275,281 @@ func (a *Api) GetAccount(ctx *gin.Context) {
 
 func (a *Api) DeleteTenant(ctx *gin.Context) {
 	id := ctx.Param("id")
-	err := a.authClient.DeleteAccount("tenant", sdk.WithId(id))
+	logWith(ctx, "tenant", id)
+	err := a.accountProvider.DeleteAccount(ctx, "tenant", id)
 	if err != nil {
-		ctx.JSON(err.StatusCode, err)
+		abort(ctx, accountError(ctx, err))
 		return
 	}
+	a.audit(ctx, model.AuditEntry{Action: "tenant.delete", TargetType: "tenant", TargetID: id}, nil, nil)
 	ctx.Status(204)
 }
 
 func (a *Api) ListTenants(ctx *gin.Context) {
-	tenants := a.authClient.ListAccounts("tenant")
+	tenants := a.accountProvider.ListAccounts(ctx, "tenant")
 	ctx.JSON(200, tenants)
 }
 
 func (a *Api) CreateTenant(ctx *gin.Context) {
-	tenant := struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-	}{}
-	if err := ctx.ShouldBindJSON(&tenant); err != nil {
-		ctx.JSON(400, gin.H{"error": "invalid request"})
+	var tenant types.CreateTenantRequest
+	if !bind(ctx, &tenant) {
 		return
 	}
-	newTenant, err := a.authClient.CreateAccount(authApi.CreateAccountRequest{
+	newTenant, err := a.accountProvider.CreateAccount(ctx, authApi.CreateAccountRequest{
 		Namespace: "tenant",
 		Email:     tenant.Email,
 		Password:  tenant.Password,
 	})
 	if err != nil {
-		ctx.JSON(err.StatusCode, err)
+		abort(ctx, accountError(ctx, err))
 		return
 	}
+	logWith(ctx, "tenant", newTenant.ID)
+	a.audit(ctx, model.AuditEntry{Action: "tenant.create", TargetType: "tenant", TargetID: newTenant.ID}, nil, newTenant)
 	ctx.JSON(201, newTenant)
 }
 
 func (a *Api) CreateOrganization(ctx *gin.Context) {
-	organization := struct {
-		Name string `json:"name"`
-	}{}
-	if err := ctx.ShouldBindJSON(&organization); err != nil {
-		ctx.JSON(400, gin.H{"error": "invalid request"})
+	var organization types.CreateOrganizationRequest
+	if !bind(ctx, &organization) {
 		return
 	}
 	newOrganization := model.Organization{
 		Name: organization.Name,
 	}
-	a.db.Create(&newOrganization)
+	if err := a.repos.Organizations.Create(ctx, &newOrganization); err != nil {
+		abort(ctx, internalError(ctx, err))
+		return
+	}
+	logWith(ctx, "organization", newOrganization.ID)
+	a.audit(ctx, model.AuditEntry{Action: "organization.create", OrganizationID: newOrganization.ID, TargetType: "organization", TargetID: newOrganization.ID}, nil, newOrganization)
 	ctx.JSON(201, newOrganization)
 }
 
 func (a *Api) DeleteOrganization(ctx *gin.Context) {
 	id := ctx.Param("id")
-	var organization model.Organization
-	err := a.db.First(&organization, id).Error
+	organization, err := a.repos.Organizations.Get(ctx, id)
 	if err != nil {
-		ctx.JSON(404, gin.H{"error": "organization not found"})
+		abort(ctx, lookupError(ctx, err, "organization"))
+		return
+	}
+	if err := a.repos.Organizations.Delete(ctx, id); err != nil {
+		abort(ctx, lookupError(ctx, err, "organization"))
 		return
 	}
-	a.db.Delete(&organization)
+	a.audit(ctx, model.AuditEntry{Action: "organization.delete", OrganizationID: id, TargetType: "organization", TargetID: id}, organization, nil)
 	ctx.Status(204)
 }
 
+func (a *Api) SetAllowedOrigins(ctx *gin.Context) {
+	organization := ctx.MustGet("organization").(model.Organization)
+	var request types.SetAllowedOriginsRequest
+	if !bind(ctx, &request) {
+		return
+	}
+	before := organization
+	organization.AllowedOrigins = make([]string, 0, len(request.Origins))
+	for _, value := range request.Origins {
+		value, _ := origin(value)
+		if !slices.Contains(organization.AllowedOrigins, value) {
+			organization.AllowedOrigins = append(organization.AllowedOrigins, value)
+		}
+	}
+	if err := a.repos.Organizations.Save(ctx, &organization); err != nil {
+		abort(ctx, internalError(ctx, err))
+		return
+	}
+	a.audit(ctx, model.AuditEntry{Action: "organization.cors", OrganizationID: organization.ID, TargetType: "organization", TargetID: organization.ID}, before, organization)
+	ctx.JSON(200, organization)
+}
+
+// organizationOf returns the id of the organization owning the resource of
+// the request, or an empty string when the route has none.
+func (a *Api) organizationOf(ctx *gin.Context) string {
+	id := ctx.Param("id")
+	switch route := ctx.FullPath(); {
+	case strings.HasPrefix(route, "/organizations/:id/"):
+		return id
+	case strings.HasPrefix(route, "/spaces/:id/"):
+		if space, err := a.repos.Spaces.Get(ctx, id); err == nil {
+			return space.OrganizationID
+		}
+	case route == "/subscriptions/:id":
+		subscription, err := a.repos.Subscriptions.Get(ctx, id)
+		if err != nil {
+			return ""
+		}
+		id = subscription.SubscriptionPlanId
+		fallthrough
+	case route == "/subscriptionPlan/:id/subscription":
+		plan, err := a.repos.SubscriptionPlans.Get(ctx, id)
+		if err != nil {
+			return ""
+		}
+		if space, err := a.repos.Spaces.Get(ctx, plan.SpaceID); err == nil {
+			return space.OrganizationID
+		}
+	}
+	return ""
+}
+
+// organizationOrigins returns the allowed origins of the organization owning
+// the resource of the request, for CORS.
+func (a *Api) organizationOrigins(ctx *gin.Context) []string {
+	organizationId := a.organizationOf(ctx)
+	if organizationId == "" {
+		return nil
+	}
+	organization, err := a.repos.Organizations.Get(ctx, organizationId)
+	if err != nil {
+		return nil
+	}
+	return organization.AllowedOrigins
+}
+
 func (a *Api) ListMyOrganizations(ctx *gin.Context) {
-	ctx.JSON(200, repo.AccountOrganizations(a.db, ctx.MustGet("account").(auth.Account)))
+	organizations, err := a.repos.Organizations.ListByAccount(ctx, ctx.MustGet("account").(auth.Account).ID)
+	if err != nil {
+		abort(ctx, internalError(ctx, err))
+		return
+	}
+	ctx.JSON(200, organizations)
 }
 
 func (a *Api) ListAllOrganizations(ctx *gin.Context) {
-	var page int64 = 0
-	var limit int64 = 10
-	if limitString := ctx.Query("limit"); limitString != "" {
-		limit, _ = strconv.ParseInt(limitString, 10, 64)
+	var query PageQuery
+	if !bindQuery(ctx, &query) {
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = 10
 	}
-	if pageString := ctx.Query("page"); pageString != "" {
-		page, _ = strconv.ParseInt(pageString, 10, 64)
+	list, err := a.repos.Organizations.List(ctx, query.Limit, query.Page)
+	if err != nil {
+		abort(ctx, internalError(ctx, err))
+		return
 	}
-	list, _ := model.ListByOption[model.Organization](a.db, int(limit), int(page))
 	ctx.JSON(200, list)
 }
 
 func (a *Api) CreateRole(ctx *gin.Context) {
 	id := ctx.Param("id")
-	role := struct {
-		Name string `json:"name"`
-	}{}
-	if err := ctx.ShouldBindJSON(&role); err != nil {
-		ctx.JSON(400, gin.H{"error": "invalid request"})
+	logWith(ctx, "organization", id)
+	var role types.CreateRoleRequest
+	if !bind(ctx, &role) {
 		return
 	}
-	var organization model.Organization
-	err := a.db.First(&organization, id).Error
+	_, err := a.repos.Organizations.Get(ctx, id)
 	if err != nil {
-		ctx.JSON(404, gin.H{"error": "organization not found"})
+		abort(ctx, lookupError(ctx, err, "organization"))
 		return
 	}
 	newRole := model.Role{
 		OrganizationID: id,
 		Name:           role.Name,
 	}
-	a.db.Create(&newRole)
+	err = a.repos.Transaction(ctx, func(tx repo.Repositories) error {
+		if err := tx.Roles.Create(ctx, &newRole); err != nil {
+			return err
+		}
+		return events.Record(ctx, tx.Outbox, model.EventRoleCreated, id, newRole)
+	})
+	if err != nil {
+		abort(ctx, internalError(ctx, err))
+		return
+	}
+	a.audit(ctx, model.AuditEntry{Action: "role.create", OrganizationID: id, TargetType: "role", TargetID: newRole.ID}, nil, newRole)
 	ctx.JSON(201, newRole)
 }
 
 func (a *Api) ListRole(ctx *gin.Context) {
 	id := ctx.Param("id")
-	var organization model.Organization
-	err := a.db.First(&organization, id).Error
+	logWith(ctx, "organization", id)
+	_, err := a.repos.Organizations.Get(ctx, id)
+	if err != nil {
+		abort(ctx, lookupError(ctx, err, "organization"))
+		return
+	}
+	roles, err := a.repos.Roles.ListByOrganization(ctx, id)
 	if err != nil {
-		ctx.JSON(404, gin.H{"error": "organization not found"})
+		abort(ctx, internalError(ctx, err))
 		return
 	}
-	var roles []model.Role
-	a.db.Where("organization_id = ?", id).Find(&roles)
 	ctx.JSON(200, roles)
 }
 
 func (a *Api) DeleteRole(ctx *gin.Context) {
 	id := ctx.Param("id")
-	err := a.db.Delete(&model.Role{}, id).Error
+	logWith(ctx, "role", id)
+	role, err := a.repos.Roles.Get(ctx, id)
+	if err != nil {
+		abort(ctx, lookupError(ctx, err, "role"))
+		return
+	}
+	err = a.repos.Transaction(ctx, func(tx repo.Repositories) error {
+		if err := tx.Roles.Delete(ctx, id); err != nil {
+			return err
+		}
+		return events.Record(ctx, tx.Outbox, model.EventRoleDeleted, role.OrganizationID, role)
+	})
+	if errors.Is(err, repo.ErrNotFound) {
+		abort(ctx, NotFound("role"))
+		return
+	}
 	if err != nil {
-		ctx.JSON(500, gin.H{"error": "internal server error"})
+		abort(ctx, internalError(ctx, err))
 		return
 	}
+	a.audit(ctx, model.AuditEntry{Action: "role.delete", OrganizationID: role.OrganizationID, TargetType: "role", TargetID: id}, role, nil)
 	ctx.Status(204)
 }
 
 func (a *Api) SetAccountRole(ctx *gin.Context) {
 	id := ctx.Param("id")
-	var roleModel model.Role
-	err := a.db.First(&roleModel, id).Error
+	roleModel, err := a.repos.Roles.Get(ctx, id)
 	if err != nil {
-		ctx.JSON(404, gin.H{"error": "role not found"})
+		abort(ctx, lookupError(ctx, err, "role"))
 		return
 	}
-	accountInfo := struct {
-		AccountId string `json:"accountId"`
-	}{}
-	if err := ctx.ShouldBindJSON(&accountInfo); err != nil {
-		ctx.JSON(400, gin.H{"error": "invalid request"})
+	logWith(ctx, "organization", roleModel.OrganizationID, "role", roleModel.ID)
+	var accountInfo types.SetAccountRoleRequest
+	if !bind(ctx, &accountInfo) {
 		return
 	}
-	account, e := a.authClient.GetAccount("tenant", sdk.WithId(accountInfo.AccountId))
+	account, e := a.accountProvider.GetAccount(ctx, "tenant", accountInfo.AccountId)
 	if e != nil {
-		ctx.JSON(e.StatusCode, e)
+		abort(ctx, accountError(ctx, e))
 		return
 	}
 
-	accountRole := model.AccountRole{
-		AccountID: account.ID,
-		RoleID:    roleModel.ID,
+	accountRole := model.AccountRole{AccountID: account.ID, RoleID: roleModel.ID}
+	err = a.repos.Transaction(ctx, func(tx repo.Repositories) error {
+		if err := tx.Roles.AddAccount(ctx, roleModel.ID, account.ID); err != nil {
+			return err
+		}
+		return events.Record(ctx, tx.Outbox, model.EventRoleAccountAdded, roleModel.OrganizationID, accountRole)
+	})
+	if err != nil {
+		abort(ctx, internalError(ctx, err))
+		return
 	}
-	a.db.Create(&accountRole)
+	a.audit(ctx, model.AuditEntry{Action: "role.account.add", OrganizationID: roleModel.OrganizationID, TargetType: "role", TargetID: roleModel.ID}, nil, accountRole)
 	ctx.Status(204)
 }
 
 func (a *Api) ListMyRoles(ctx *gin.Context) {
 	account := ctx.MustGet("account").(auth.Account)
-	ctx.JSON(200, repo.AccountRoles(a.db, account))
+	roles, err := a.repos.Roles.ListByAccount(ctx, account.ID)
+	if err != nil {
+		abort(ctx, internalError(ctx, err))
+		return
+	}
+	ctx.JSON(200, roles)
 }
 
 func (a *Api) CreateSpace(ctx *gin.Context) {
-	var request CreateSpaceRequest
-	if err := ctx.ShouldBindJSON(&request); err != nil {
-		ctx.JSON(400, gin.H{"error": "invalid request"})
+	var request types.CreateSpaceRequest
+	if !bind(ctx, &request) {
 		return
 	}
 	organizationId := ctx.Param("id")
@@ -371,126 +558,221 @@ func (a *Api) CreateSpace(ctx *gin.Context) {
 		Name:           request.Name,
 		ParentId:       request.ParentId,
 	}
-	a.db.Create(&space)
+	err := a.repos.Transaction(ctx, func(tx repo.Repositories) error {
+		if err := tx.Spaces.Create(ctx, &space); err != nil {
+			return err
+		}
+		return events.Record(ctx, tx.Outbox, model.EventSpaceCreated, organizationId, space)
+	})
+	if err != nil {
+		abort(ctx, internalError(ctx, err))
+		return
+	}
+	a.audit(ctx, model.AuditEntry{Action: "space.create", OrganizationID: organizationId, TargetType: "space", TargetID: space.ID}, nil, space)
 	ctx.JSON(201, space)
 }
 
+func (a *Api) UpdateSpace(ctx *gin.Context) {
+	space := ctx.MustGet("space").(model.Space)
+	var request types.UpdateSpaceRequest
+	if !bind(ctx, &request) {
+		return
+	}
+	before := space
+	space.Name = request.Name
+	err := a.repos.Transaction(ctx, func(tx repo.Repositories) error {
+		if err := tx.Spaces.Save(ctx, &space); err != nil {
+			return err
+		}
+		return events.Record(ctx, tx.Outbox, model.EventSpaceUpdated, space.OrganizationID, space)
+	})
+	if err != nil {
+		abort(ctx, internalError(ctx, err))
+		return
+	}
+	a.audit(ctx, model.AuditEntry{Action: "space.update", OrganizationID: space.OrganizationID, TargetType: "space", TargetID: space.ID}, before, space)
+	ctx.JSON(200, space)
+}
+
 func (a *Api) ListSpaces(ctx *gin.Context) {
 	organizationId := ctx.Param("id")
-	var spaces []model.Space
-	a.db.Where("organization_id = ?", organizationId).Find(&spaces)
+	spaces, err := a.repos.Spaces.ListByOrganization(ctx, organizationId)
+	if err != nil {
+		abort(ctx, internalError(ctx, err))
+		return
+	}
 	ctx.JSON(200, spaces)
 }
 
 func (a *Api) DeleteSpace(ctx *gin.Context) {
 	id := ctx.Param("id")
-	var space model.Space
-	err := a.db.First(&space, id).Error
+	space, err := a.repos.Spaces.Get(ctx, id)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			ctx.JSON(404, gin.H{"error": "space not found"})
-			return
-		}
-		ctx.JSON(500, gin.H{"error": "internal server error"})
+		abort(ctx, lookupError(ctx, err, "space"))
 		return
 	}
-	a.db.Delete(&space)
+	if err := a.repos.Spaces.Delete(ctx, id); err != nil {
+		abort(ctx, lookupError(ctx, err, "space"))
+		return
+	}
+	a.audit(ctx, model.AuditEntry{Action: "space.delete", OrganizationID: space.OrganizationID, TargetType: "space", TargetID: id}, space, nil)
 	ctx.Status(204)
 }
 
 func (a *Api) SpaceChildren(ctx *gin.Context) {
 	space := ctx.MustGet("space").(model.Space)
-	ctx.JSON(200, space.Children(a.db))
+	children, err := a.repos.Spaces.Children(ctx, space.ID)
+	if err != nil {
+		abort(ctx, internalError(ctx, err))
+		return
+	}
+	ctx.JSON(200, children)
 }
 
 func (a *Api) CreateConsumer(ctx *gin.Context) {
 	organization := ctx.MustGet("organization").(model.Organization)
-	var request CreateConsumerRequest
-	if err := ctx.ShouldBindJSON(&request); err != nil {
-		ctx.JSON(400, gin.H{"error": "invalid request"})
+	var request types.CreateConsumerRequest
+	if !bind(ctx, &request) {
 		return
 	}
-	account, err := a.authClient.CreateAccount(authApi.CreateAccountRequest{
+	account, err := a.accountProvider.CreateAccount(ctx, authApi.CreateAccountRequest{
 		Namespace:   "org/" + organization.ID,
 		PhoneRegion: request.PhoneRegion,
 		PhoneNumber: request.PhoneNumber,
 		Password:    request.Password,
 	})
 	if err != nil {
-		ctx.JSON(err.StatusCode, err)
+		abort(ctx, accountError(ctx, err))
 		return
 	}
+	a.audit(ctx, model.AuditEntry{Action: "consumer.create", OrganizationID: organization.ID, TargetType: "consumer", TargetID: account.ID}, nil, account)
+	// The account lives in the auth service, so the event cannot share its
+	// transaction.
+	if err := events.Record(ctx, a.repos.Outbox, model.EventConsumerCreated, organization.ID, account); err != nil {
+		loggerOf(ctx).Error("recording event failed", "event", model.EventConsumerCreated, "error", err)
+	}
 	ctx.JSON(201, account)
 }
 
 func (a *Api) ListConsumer(ctx *gin.Context) {
 	organization := ctx.MustGet("organization").(model.Organization)
-	ctx.JSON(200, a.authClient.ListAccounts("org/"+organization.ID))
+	ctx.JSON(200, a.accountProvider.ListAccounts(ctx, "org/"+organization.ID))
 }
 
 func (a *Api) CreateSubscriptionPlan(ctx *gin.Context) {
 	space := ctx.MustGet("space").(model.Space)
-	var request CreateSubscriptionPlanRequest
-	if err := ctx.ShouldBindJSON(&request); err != nil {
-		ctx.JSON(400, gin.H{"error": "invalid request"})
+	var request types.CreateSubscriptionPlanRequest
+	if !bind(ctx, &request) {
 		return
 	}
-	subscriptionPlan, err := space.CreateSubscriptionPlan(a.db, request.PlanName, request.PaymentGateway, request.Currency, request.Price)
+	subscriptionPlan := model.SubscriptionPlan{
+		PlanName:       request.PlanName,
+		PaymentGateway: request.PaymentGateway,
+		SpaceID:        space.ID,
+		Currency:       request.Currency,
+		Price:          request.Price,
+	}
+	err := a.repos.SubscriptionPlans.Create(ctx, &subscriptionPlan)
 	if err != nil {
-		ctx.JSON(500, gin.H{
-			"error": "internal server error",
-		})
+		abort(ctx, internalError(ctx, err))
 		return
 	}
+	a.audit(ctx, model.AuditEntry{Action: "subscriptionPlan.create", OrganizationID: space.OrganizationID, TargetType: "subscriptionPlan", TargetID: subscriptionPlan.ID}, nil, subscriptionPlan)
 	ctx.JSON(201, subscriptionPlan)
 }
 
 func (a *Api) ListSubscriptionPlans(ctx *gin.Context) {
 	space := ctx.MustGet("space").(model.Space)
-	ctx.JSON(200, space.SubscriptionPlans(a.db))
+	subscriptionPlans, err := a.repos.SubscriptionPlans.ListBySpace(ctx, space.ID)
+	if err != nil {
+		abort(ctx, internalError(ctx, err))
+		return
+	}
+	ctx.JSON(200, subscriptionPlans)
+}
+
+func (a *Api) ListEntitlements(ctx *gin.Context) {
+	space := ctx.MustGet("space").(model.Space)
+	plans, err := a.repos.SubscriptionPlans.ListBySpace(ctx, space.ID)
+	if err != nil {
+		abort(ctx, internalError(ctx, err))
+		return
+	}
+	entitlements := make([]types.Entitlement, 0)
+	for _, plan := range plans {
+		subscriptions, err := a.repos.Subscriptions.ListActive(ctx, plan.ID)
+		if err != nil {
+			abort(ctx, internalError(ctx, err))
+			return
+		}
+		for _, subscription := range subscriptions {
+			entitlements = append(entitlements, types.Entitlement{
+				SubscriptionPlanID: plan.ID,
+				PlanName:           plan.PlanName,
+				SubscriptionID:     subscription.ID,
+				Status:             subscription.Status,
+			})
+		}
+	}
+	ctx.JSON(200, entitlements)
 }
 
 func (a *Api) CreateSubscription(ctx *gin.Context) {
 	id := ctx.Param("id")
-	var subscriptionPlan model.SubscriptionPlan
-	err := a.db.First(&subscriptionPlan, id).Error
+	subscriptionPlan, err := a.repos.SubscriptionPlans.Get(ctx, id)
 	if err != nil {
-		ctx.JSON(404, gin.H{"error": "subscription plan not found"})
+		abort(ctx, lookupError(ctx, err, "subscription plan"))
+		return
+	}
+	logWith(ctx, "space", subscriptionPlan.SpaceID, "plan", subscriptionPlan.ID)
+	subscription, sub, err := a.billing.CreateSubscription(ctx, subscriptionPlan)
+	if errors.Is(err, billing.ErrSubscriptionExists) {
+		abort(ctx, Conflict(err.Error()))
 		return
 	}
-	sub, err := subscriptionPlan.CreateSubscription(a.db)
 	if err != nil {
-		ctx.JSON(500, gin.H{"error": err.Error()})
+		abort(ctx, internalError(ctx, err))
 		return
 	}
-	ctx.JSON(201, gin.H{"paymentLink": sub.Link, "id": sub.ID})
+	a.audit(ctx, model.AuditEntry{Action: "subscription.checkout", OrganizationID: a.organizationOf(ctx), TargetType: "subscriptionPlan", TargetID: subscriptionPlan.ID}, nil, nil)
+	ctx.JSON(201, types.Checkout{ID: subscription.ID, PaymentLink: sub.Link, Secret: subscription.Secret})
 }
 
 func (a *Api) CancelSubscription(ctx *gin.Context) {
 	id := ctx.Param("id")
-	var subscription model.Subscription
-	err := a.db.First(&subscription, id).Error
+	subscription, err := a.repos.Subscriptions.Get(ctx, id)
 	if err != nil {
-		ctx.JSON(404, gin.H{"error": "subscription not found"})
+		abort(ctx, lookupError(ctx, err, "subscription"))
 		return
 	}
-	var request CancelSubscriptionRequest
-	if err := ctx.ShouldBindJSON(&request); err != nil {
-		ctx.JSON(400, gin.H{"error": "invalid request"})
+	logWith(ctx, "subscription", subscription.ID, "plan", subscription.SubscriptionPlanId)
+	var request types.CancelSubscriptionRequest
+	if !bind(ctx, &request) {
 		return
 	}
 	if subscription.Secret != request.Secret {
-		ctx.JSON(401, gin.H{"error": "unauthorized"})
+		abort(ctx, ErrForbidden)
+		return
+	}
+	if subscription.Ended() {
+		abort(ctx, Conflict("subscription already "+subscription.Status))
+		return
+	}
+	before := *subscription
+	err = a.billing.Cancel(ctx, subscription)
+	if errors.Is(err, billing.ErrNotCompleted) || errors.Is(err, model.ErrInvalidTransition) {
+		abort(ctx, Conflict(err.Error()))
 		return
 	}
-	if subscription.CanceledAt != nil {
-		ctx.JSON(400, gin.H{"error": "subscription already canceled"})
+	if errors.Is(err, billing.ErrGatewayFailed) {
+		ctx.Error(err)
+		abort(ctx, ErrPaymentFailed)
 		return
 	}
-	err = subscription.Cancel(a.db)
 	if err != nil {
-		ctx.JSON(500, gin.H{"error": err.Error()})
+		abort(ctx, internalError(ctx, err))
 		return
 	}
+	a.audit(ctx, model.AuditEntry{Action: "subscription.cancel", OrganizationID: a.organizationOf(ctx), TargetType: "subscription", TargetID: subscription.ID}, before, subscription)
 	ctx.Status(204)
 }
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	authApi "github.com/alterminal/auth/api"
+	auth "github.com/alterminal/auth/model"
+	"github.com/alterminal/member/accounts"
+	"github.com/alterminal/member/health"
+	"github.com/alterminal/member/model"
+	"github.com/alterminal/member/ratelimit"
+	"github.com/alterminal/member/repo"
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func newTestRouter(repos repo.Repositories, provider accounts.AccountProvider) *gin.Engine {
+	return NewRouter(repos, nil, nil, nil, provider, Options{
+		Health:     health.New(time.Second),
+		CORS:       NewCORS(CORSConfig{}, CORSConfig{}, CORSConfig{}),
+		RateLimits: NewRateLimits(ratelimit.NewMemory(), RateLimit{}, RateLimit{}, RateLimit{}),
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+}
+
+func createAccount(t *testing.T, provider *accounts.Memory, namespace, email string) (auth.Account, string) {
+	t.Helper()
+	account, err := provider.CreateAccount(context.Background(), authApi.CreateAccountRequest{Namespace: namespace, Email: email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return account, provider.IssueToken(account.ID)
+}
+
+func serve(router http.Handler, method, path, token, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestGetAccount(t *testing.T) {
+	provider := accounts.NewMemory()
+	admin, token := createAccount(t, provider, "admin", "admin@example.com")
+	for _, test := range []struct {
+		name          string
+		authorization string
+		account       string
+	}{
+		{"valid token", "Bearer " + token, admin.ID},
+		{"unknown token", "Bearer unknown", ""},
+		{"missing scheme", token, ""},
+		{"missing header", "", ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			ctx.Request = httptest.NewRequest("GET", "/", nil)
+			ctx.Request.Header.Set("Authorization", test.authorization)
+			GetAccount(provider)(ctx)
+			account, ok := ctx.Get("account")
+			if test.account == "" {
+				if ok {
+					t.Errorf("account = %v, want none", account)
+				}
+				return
+			}
+			if !ok || account.(auth.Account).ID != test.account {
+				t.Errorf("account = %v, want %s", account, test.account)
+			}
+		})
+	}
+}
+
+func TestNamespaceGuards(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		guard     gin.HandlerFunc
+		namespace string
+		status    int
+	}{
+		{"admin as admin", IsAdmin, "admin", 200},
+		{"admin as tenant", IsAdmin, "tenant", 403},
+		{"admin anonymous", IsAdmin, "", 401},
+		{"tenant as tenant", IsTenant, "tenant", 200},
+		{"tenant as admin", IsTenant, "admin", 403},
+		{"tenant anonymous", IsTenant, "", 401},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(recorder)
+			ctx.Request = httptest.NewRequest("GET", "/", nil)
+			if test.namespace != "" {
+				ctx.Set("account", auth.Account{ID: model.NewID(), Namespace: test.namespace})
+			}
+			test.guard(ctx)
+			if ctx.IsAborted() != (test.status != 200) {
+				t.Errorf("aborted = %t", ctx.IsAborted())
+			}
+			if ctx.IsAborted() && recorder.Code != test.status {
+				t.Errorf("status = %d, want %d", recorder.Code, test.status)
+			}
+		})
+	}
+}
+
+func TestCreateConsumer(t *testing.T) {
+	ctx := context.Background()
+	repos := repo.NewMemory()
+	provider := accounts.NewMemory()
+	router := newTestRouter(repos, provider)
+	tenant, tenantToken := createAccount(t, provider, "tenant", "tenant@example.com")
+	_, otherToken := createAccount(t, provider, "tenant", "other@example.com")
+	organization := model.Organization{Name: "organization"}
+	if err := repos.Organizations.Create(ctx, &organization); err != nil {
+		t.Fatal(err)
+	}
+	role := model.Role{OrganizationID: organization.ID, Name: "admin"}
+	if err := repos.Roles.Create(ctx, &role); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Roles.AddAccount(ctx, role.ID, tenant.ID); err != nil {
+		t.Fatal(err)
+	}
+	path := "/organizations/" + organization.ID + "/consumers"
+	consumer := `{"phoneRegion": "852", "phoneNumber": "91234567", "password": "secret"}`
+	for _, test := range []struct {
+		name   string
+		token  string
+		body   string
+		status int
+		code   string
+	}{
+		{"created", tenantToken, consumer, 201, ""},
+		{"duplicate", tenantToken, consumer, 409, "conflict"},
+		{"invalid phone number", tenantToken, `{"phoneRegion": "852", "phoneNumber": "abc", "password": "secret"}`, 400, "invalid_request"},
+		{"not an organization admin", otherToken, consumer, 403, "forbidden"},
+		{"anonymous", "", consumer, 401, "unauthorized"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := serve(router, "POST", path, test.token, test.body)
+			if recorder.Code != test.status {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, test.status, recorder.Body)
+			}
+			if test.code == "" {
+				return
+			}
+			var response Error
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Code != test.code {
+				t.Errorf("code = %q, want %q", response.Code, test.code)
+			}
+		})
+	}
+	consumers := provider.ListAccounts(ctx, "org/"+organization.ID)
+	if len(consumers) != 1 || consumers[0].PhoneNumber != "91234567" {
+		t.Errorf("consumers = %+v", consumers)
+	}
+}
+
+func TestListAllOrganizationsPage(t *testing.T) {
+	provider := accounts.NewMemory()
+	_, token := createAccount(t, provider, "admin", "admin@example.com")
+	router := newTestRouter(repo.NewMemory(), provider)
+	for _, test := range []struct {
+		query  string
+		status int
+	}{
+		{"", 200},
+		{"?limit=100&page=3", 200},
+		{"?limit=0", 200},
+		{"?limit=-1", 400},
+		{"?limit=101", 400},
+		{"?page=-1", 400},
+		{"?limit=ten", 400},
+	} {
+		if recorder := serve(router, "GET", "/organizations/all"+test.query, token, ""); recorder.Code != test.status {
+			t.Errorf("%q: status = %d, want %d", test.query, recorder.Code, test.status)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+
+	auth "github.com/alterminal/auth/model"
+	"github.com/alterminal/member/model"
+	"github.com/alterminal/member/repo"
+	"github.com/gin-gonic/gin"
+)
+
+// redacted fields never reach the audit log, at any depth. A field is
+// redacted when its name contains one of them, ignoring case.
+var redacted = []string{"secret", "password", "token"}
+
+// audit appends entry for a change made by the request, with the fields
+// that differ between before and after. The change is already made, so a
+// failed write is logged rather than failing the request.
+func (a *Api) audit(ctx *gin.Context, entry model.AuditEntry, before, after any) {
+	if account, ok := ctx.Get("account"); ok {
+		entry.ActorID = account.(auth.Account).ID
+	}
+	entry.IP = ctx.ClientIP()
+	entry.RequestID = ctx.GetString("requestId")
+	entry.Before, entry.After = diff(fields(before), fields(after))
+	if err := a.repos.AuditLog.Append(ctx, &entry); err != nil {
+		loggerOf(ctx).Error("audit write failed", "action", entry.Action, "target", entry.TargetID, "error", err)
+	}
+}
+
+func fields(value any) map[string]any {
+	if value == nil {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var result map[string]any
+	json.Unmarshal(data, &result)
+	redact(result)
+	return result
+}
+
+// redact removes the redacted fields of value and of the objects it holds.
+func redact(value any) {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, field := range value {
+			name := strings.ToLower(key)
+			if slices.ContainsFunc(redacted, func(redacted string) bool { return strings.Contains(name, redacted) }) {
+				delete(value, key)
+				continue
+			}
+			redact(field)
+		}
+	case []any:
+		for _, item := range value {
+			redact(item)
+		}
+	}
+}
+
+func diff(before, after map[string]any) (map[string]any, map[string]any) {
+	for key, value := range before {
+		if other, ok := after[key]; ok && reflect.DeepEqual(value, other) {
+			delete(before, key)
+			delete(after, key)
+		}
+	}
+	if len(before) == 0 {
+		before = nil
+	}
+	if len(after) == 0 {
+		after = nil
+	}
+	return before, after
+}
+
+func (a *Api) ListOrganizationAudit(ctx *gin.Context) {
+	organization := ctx.MustGet("organization").(model.Organization)
+	var query AuditQuery
+	if !bindQuery(ctx, &query) {
+		return
+	}
+	query.OrganizationId = organization.ID
+	a.searchAudit(ctx, query)
+}
+
+func (a *Api) SearchAudit(ctx *gin.Context) {
+	var query AuditQuery
+	if !bindQuery(ctx, &query) {
+		return
+	}
+	a.searchAudit(ctx, query)
+}
+
+func (a *Api) searchAudit(ctx *gin.Context, query AuditQuery) {
+	if query.Limit == 0 {
+		query.Limit = 10
+	}
+	list, err := a.repos.AuditLog.Search(ctx, repo.AuditFilter{
+		OrganizationID: query.OrganizationId,
+		ActorID:        query.ActorId,
+		Action:         query.Action,
+		TargetType:     query.TargetType,
+		TargetID:       query.TargetId,
+		Since:          query.Since,
+		Until:          query.Until,
+	}, query.Limit, query.Page)
+	if err != nil {
+		abort(ctx, internalError(ctx, err))
+		return
+	}
+	ctx.JSON(200, list)
+}
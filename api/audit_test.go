@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alterminal/member/accounts"
+	"github.com/alterminal/member/model"
+	"github.com/alterminal/member/repo"
+)
+
+func TestAuditDiff(t *testing.T) {
+	type settings struct {
+		Origins []string `json:"origins"`
+		MaxAge  int      `json:"maxAge"`
+	}
+	type organization struct {
+		Name     string   `json:"name"`
+		Plan     string   `json:"plan,omitempty"`
+		Settings settings `json:"settings"`
+	}
+	base := organization{Name: "organization", Plan: "free", Settings: settings{Origins: []string{"https://a.example"}, MaxAge: 60}}
+	renamed := base
+	renamed.Name = "renamed"
+	reordered := base
+	reordered.Settings = settings{Origins: []string{"https://b.example"}, MaxAge: 60}
+	dropped := base
+	dropped.Plan = ""
+	for _, test := range []struct {
+		name          string
+		before, after any
+		wantBefore    map[string]any
+		wantAfter     map[string]any
+	}{
+		{"changed field", base, renamed, map[string]any{"name": "organization"}, map[string]any{"name": "renamed"}},
+		{"unchanged", base, base, nil, nil},
+		{"nested field", base, reordered,
+			map[string]any{"settings": map[string]any{"origins": []any{"https://a.example"}, "maxAge": float64(60)}},
+			map[string]any{"settings": map[string]any{"origins": []any{"https://b.example"}, "maxAge": float64(60)}}},
+		{"removed field", base, dropped, map[string]any{"plan": "free"}, nil},
+		{"created", nil, renamed, nil, fields(renamed)},
+		{"deleted", base, nil, fields(base), nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			before, after := diff(fields(test.before), fields(test.after))
+			if !reflect.DeepEqual(before, test.wantBefore) || !reflect.DeepEqual(after, test.wantAfter) {
+				t.Errorf("diff = %v, %v, want %v, %v", before, after, test.wantBefore, test.wantAfter)
+			}
+		})
+	}
+}
+
+func TestAuditRedaction(t *testing.T) {
+	type credentials struct {
+		AccessToken string `json:"accessToken"`
+		Username    string `json:"username"`
+	}
+	value := struct {
+		ID          string        `json:"id"`
+		Password    string        `json:"password"`
+		Secret      string        `json:"secret"`
+		Token       string        `json:"token"`
+		Credentials credentials   `json:"credentials"`
+		Endpoints   []credentials `json:"endpoints"`
+	}{
+		ID:          "1",
+		Password:    "hunter2",
+		Secret:      "whsec_1",
+		Token:       "token_1",
+		Credentials: credentials{AccessToken: "token_2", Username: "user"},
+		Endpoints:   []credentials{{AccessToken: "token_3", Username: "user"}},
+	}
+	result := fields(value)
+	want := map[string]any{
+		"id":          "1",
+		"credentials": map[string]any{"username": "user"},
+		"endpoints":   []any{map[string]any{"username": "user"}},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("fields = %v, want %v", result, want)
+	}
+}
+
+func TestAuditEntryOfRequest(t *testing.T) {
+	ctx := context.Background()
+	repos := repo.NewMemory()
+	provider := accounts.NewMemory()
+	router := newTestRouter(repos, provider)
+	tenant, token := createAccount(t, provider, "tenant", "tenant@example.com")
+	organization := model.Organization{Name: "organization"}
+	if err := repos.Organizations.Create(ctx, &organization); err != nil {
+		t.Fatal(err)
+	}
+	role := model.Role{OrganizationID: organization.ID, Name: "admin"}
+	if err := repos.Roles.Create(ctx, &role); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Roles.AddAccount(ctx, role.ID, tenant.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	request := httptest.NewRequest("PUT", "/organizations/"+organization.ID+"/cors", strings.NewReader(`{"origins": ["https://example.com"]}`))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+token)
+	request.Header.Set("X-Request-Id", "request-1")
+	request.RemoteAddr = "192.0.2.7:1234"
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	if recorder.Code != 200 {
+		t.Fatalf("status = %d: %s", recorder.Code, recorder.Body)
+	}
+
+	entries, err := repos.AuditLog.Search(ctx, repo.AuditFilter{OrganizationID: organization.ID}, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries.Items) != 1 {
+		t.Fatalf("entries = %d, want 1", len(entries.Items))
+	}
+	entry := entries.Items[0]
+	if entry.Action != "organization.cors" || entry.ActorID != tenant.ID || entry.IP != "192.0.2.7" || entry.RequestID != "request-1" {
+		t.Errorf("entry = %+v", entry)
+	}
+	if entry.Before["allowedOrigins"] != nil || !reflect.DeepEqual(entry.After["allowedOrigins"], []any{"https://example.com"}) {
+		t.Errorf("before = %v, after = %v", entry.Before, entry.After)
+	}
+}
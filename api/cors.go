@@ -0,0 +1,112 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CORSConfig struct {
+	// Origins lists the allowed origins. "*" allows every origin.
+	Origins     []string
+	Headers     []string
+	Methods     []string
+	Credentials bool
+	MaxAge      time.Duration
+}
+
+// CORSPolicy answers cross origin requests for one route group. Its config
+// can be replaced while serving.
+type CORSPolicy struct {
+	config atomic.Pointer[CORSConfig]
+	// extraOrigins returns origins allowed for the resource of the request
+	// on top of the configured ones.
+	extraOrigins func(ctx *gin.Context) []string
+}
+
+func NewCORSPolicy(config CORSConfig) *CORSPolicy {
+	p := &CORSPolicy{}
+	p.Set(config)
+	return p
+}
+
+func (p *CORSPolicy) Set(config CORSConfig) {
+	p.config.Store(&config)
+}
+
+// CORS holds the policies of the public, tenant and admin route groups.
+type CORS struct {
+	Public *CORSPolicy
+	Tenant *CORSPolicy
+	Admin  *CORSPolicy
+}
+
+func NewCORS(public, tenant, admin CORSConfig) *CORS {
+	return &CORS{
+		Public: NewCORSPolicy(public),
+		Tenant: NewCORSPolicy(tenant),
+		Admin:  NewCORSPolicy(admin),
+	}
+}
+
+func (p *CORSPolicy) allowed(ctx *gin.Context, config *CORSConfig, origin string) bool {
+	if slices.Contains(config.Origins, "*") || slices.Contains(config.Origins, origin) {
+		return true
+	}
+	return p.extraOrigins != nil && slices.Contains(p.extraOrigins(ctx), origin)
+}
+
+// Handle adds the CORS headers to requests from allowed origins.
+func (p *CORSPolicy) Handle(ctx *gin.Context) {
+	origin := ctx.GetHeader("Origin")
+	if origin == "" {
+		return
+	}
+	ctx.Header("Vary", "Origin")
+	config := p.config.Load()
+	if !p.allowed(ctx, config, origin) {
+		return
+	}
+	ctx.Header("Access-Control-Allow-Origin", origin)
+	ctx.Header("Access-Control-Expose-Headers", "X-Request-Id")
+	if config.Credentials {
+		ctx.Header("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// preflight answers an OPTIONS request asking whether the actual request
+// may be sent.
+func (p *CORSPolicy) preflight(ctx *gin.Context) {
+	origin := ctx.GetHeader("Origin")
+	method := ctx.GetHeader("Access-Control-Request-Method")
+	config := p.config.Load()
+	ctx.Header("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+	if !p.allowed(ctx, config, origin) || !slices.Contains(config.Methods, method) {
+		abort(ctx, NewError(http.StatusForbidden, "cross origin request not allowed"))
+		return
+	}
+	for _, header := range strings.Split(ctx.GetHeader("Access-Control-Request-Headers"), ",") {
+		header = strings.TrimSpace(header)
+		if header != "" && !slices.ContainsFunc(config.Headers, func(allowed string) bool {
+			return strings.EqualFold(allowed, header)
+		}) {
+			abort(ctx, NewError(http.StatusForbidden, "header "+header+" not allowed"))
+			return
+		}
+	}
+	ctx.Header("Access-Control-Allow-Origin", origin)
+	ctx.Header("Access-Control-Allow-Methods", strings.Join(config.Methods, ", "))
+	ctx.Header("Access-Control-Allow-Headers", strings.Join(config.Headers, ", "))
+	if config.Credentials {
+		ctx.Header("Access-Control-Allow-Credentials", "true")
+	}
+	if config.MaxAge > 0 {
+		ctx.Header("Access-Control-Max-Age", strconv.Itoa(int(config.MaxAge.Seconds())))
+	}
+	ctx.AbortWithStatus(http.StatusNoContent)
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/alterminal/member/accounts"
+	"github.com/alterminal/member/repo"
+	"github.com/gin-gonic/gin"
+)
+
+// Error is the body of every failed response.
+type Error struct {
+	Status    int          `json:"-"`
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestID string       `json:"requestId,omitempty"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+var statusCodes = map[int]string{
+	400: "invalid_request",
+	401: "unauthorized",
+	403: "forbidden",
+	404: "not_found",
+	405: "method_not_allowed",
+	409: "conflict",
+	429: "too_many_requests",
+	500: "internal_error",
+	502: "bad_gateway",
+	503: "service_unavailable",
+}
+
+var (
+	ErrInvalidRequest = NewError(400, "invalid request")
+	ErrUnauthorized   = NewError(401, "authentication required")
+	ErrForbidden      = NewError(403, "permission denied")
+	ErrInternal       = NewError(500, "internal server error")
+	ErrAuthFailed     = NewError(502, "auth service failed")
+	ErrAuthDown       = NewError(503, "auth service unavailable")
+	ErrPaymentFailed  = NewError(502, "payment gateway failed, try again")
+)
+
+func NewError(status int, message string) *Error {
+	code, ok := statusCodes[status]
+	if !ok {
+		code = "error"
+	}
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func NotFound(resource string) *Error {
+	return NewError(404, resource+" not found")
+}
+
+// lookupError maps a repository error from loading a resource.
+func lookupError(ctx *gin.Context, err error, resource string) *Error {
+	if errors.Is(err, repo.ErrNotFound) {
+		return NotFound(resource)
+	}
+	return internalError(ctx, err)
+}
+
+// internalError records err for the access log and hides it from the client.
+func internalError(ctx *gin.Context, err error) *Error {
+	ctx.Error(err)
+	return ErrInternal
+}
+
+func Conflict(message string) *Error {
+	return NewError(409, message)
+}
+
+// accountError maps a failed call to the auth service. Only answers about the
+// request itself are passed on; any other failure, including the service
+// rejecting our own credentials, is the service's and not the caller's.
+func accountError(ctx *gin.Context, err *accounts.Error) *Error {
+	switch err.StatusCode {
+	case 400, 404, 409:
+		return NewError(err.StatusCode, err.Error())
+	case 0, 502, 503, 504:
+		ctx.Error(err)
+		return ErrAuthDown
+	}
+	ctx.Error(err)
+	return ErrAuthFailed
+}
+
+func abort(ctx *gin.Context, err *Error) {
+	response := *err
+	response.RequestID = ctx.GetString("requestId")
+	ctx.AbortWithStatusJSON(response.Status, response)
+}
+
+func recovery(ctx *gin.Context, recovered any) {
+	abort(ctx, internalError(ctx, fmt.Errorf("panic: %v", recovered)))
+}
+
+func noRoute(ctx *gin.Context) {
+	abort(ctx, NewError(http.StatusNotFound, "route not found"))
+}
+
+func noMethod(ctx *gin.Context) {
+	abort(ctx, NewError(http.StatusMethodNotAllowed, "method not allowed"))
+}
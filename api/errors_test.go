@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alterminal/member/accounts"
+	"github.com/gin-gonic/gin"
+)
+
+func TestAccountError(t *testing.T) {
+	for _, test := range []struct {
+		upstream int
+		status   int
+	}{
+		{400, 400},
+		{404, 404},
+		{409, 409},
+		{401, 502},
+		{403, 502},
+		{500, 502},
+		{0, 503},
+		{503, 503},
+		{504, 503},
+	} {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		if err := accountError(ctx, accounts.NewError(test.upstream, "")); err.Status != test.status {
+			t.Errorf("upstream %d: status = %d, want %d", test.upstream, err.Status, test.status)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// routeGroup registers routes under a CORS policy and a rate limiter and
+// remembers both per path and method. Preflight requests match no route, so
+// every path gets an OPTIONS route that applies the ones of the method asked
+// for. The limiter runs first, as the CORS policy may look up the origins of
+// an organization.
+type routeGroup struct {
+	router  *gin.Engine
+	policy  *CORSPolicy
+	limiter *RateLimiter
+	routes  map[string]map[string]*routeGroup
+}
+
+func newRouteGroups(router *gin.Engine) func(policy *CORSPolicy, limiter *RateLimiter) *routeGroup {
+	routes := map[string]map[string]*routeGroup{}
+	return func(policy *CORSPolicy, limiter *RateLimiter) *routeGroup {
+		return &routeGroup{router: router, policy: policy, limiter: limiter, routes: routes}
+	}
+}
+
+func (g *routeGroup) handle(method, path string, handlers ...gin.HandlerFunc) {
+	g.router.Handle(method, path, append([]gin.HandlerFunc{g.limiter.Handle, g.policy.Handle}, handlers...)...)
+	groups, ok := g.routes[path]
+	if !ok {
+		groups = map[string]*routeGroup{}
+		g.routes[path] = groups
+		g.router.OPTIONS(path, func(ctx *gin.Context) {
+			group, ok := groups[ctx.GetHeader("Access-Control-Request-Method")]
+			if !ok || ctx.GetHeader("Origin") == "" {
+				ctx.Status(http.StatusNoContent)
+				return
+			}
+			if group.limiter.Handle(ctx); ctx.IsAborted() {
+				return
+			}
+			group.policy.preflight(ctx)
+		})
+	}
+	groups[method] = g
+}
+
+func (g *routeGroup) GET(path string, handlers ...gin.HandlerFunc) {
+	g.handle(http.MethodGet, path, handlers...)
+}
+
+func (g *routeGroup) POST(path string, handlers ...gin.HandlerFunc) {
+	g.handle(http.MethodPost, path, handlers...)
+}
+
+func (g *routeGroup) PUT(path string, handlers ...gin.HandlerFunc) {
+	g.handle(http.MethodPut, path, handlers...)
+}
+
+func (g *routeGroup) DELETE(path string, handlers ...gin.HandlerFunc) {
+	g.handle(http.MethodDelete, path, handlers...)
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alterminal/member/accounts"
+	"github.com/alterminal/member/health"
+	"github.com/alterminal/member/model"
+	"github.com/alterminal/member/ratelimit"
+	"github.com/alterminal/member/repo"
+)
+
+type countingSubscriptions struct {
+	repo.Subscriptions
+	gets int
+}
+
+func (s *countingSubscriptions) Get(ctx context.Context, id string) (*model.Subscription, error) {
+	s.gets++
+	return s.Subscriptions.Get(ctx, id)
+}
+
+// TestRateLimitBeforeCORS checks that requests over the IP limit are refused
+// before the CORS policy looks up the origins of their organization.
+func TestRateLimitBeforeCORS(t *testing.T) {
+	repos := repo.NewMemory()
+	subscriptions := &countingSubscriptions{Subscriptions: repos.Subscriptions}
+	repos.Subscriptions = subscriptions
+	limit := RateLimit{IP: ratelimit.Limit{Rate: 0.001, Burst: 1}}
+	router := NewRouter(repos, nil, nil, nil, accounts.NewMemory(), Options{
+		Health:     health.New(time.Second),
+		CORS:       NewCORS(CORSConfig{}, CORSConfig{}, CORSConfig{}),
+		RateLimits: NewRateLimits(ratelimit.NewMemory(), limit, RateLimit{}, RateLimit{}),
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	for i, method := range []string{"DELETE", "OPTIONS"} {
+		t.Run(method, func(t *testing.T) {
+			subscriptions.gets = 0
+			request := httptest.NewRequest(method, "/subscriptions/"+model.NewID(), nil)
+			request.RemoteAddr = fmt.Sprintf("192.0.2.%d:1234", i+1)
+			request.Header.Set("Origin", "https://example.com")
+			request.Header.Set("Access-Control-Request-Method", "DELETE")
+			if recorder := serveRequest(router, request); recorder.Code == 429 || subscriptions.gets == 0 {
+				t.Fatalf("first request: status = %d, lookups = %d", recorder.Code, subscriptions.gets)
+			}
+			lookups := subscriptions.gets
+			for range 2 {
+				if recorder := serveRequest(router, request); recorder.Code != 429 {
+					t.Errorf("status = %d, want 429", recorder.Code)
+				}
+			}
+			if subscriptions.gets != lookups {
+				t.Errorf("lookups = %d, want %d", subscriptions.gets, lookups)
+			}
+		})
+	}
+}
+
+func serveRequest(router http.Handler, request *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
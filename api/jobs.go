@@ -0,0 +1,66 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/alterminal/member/model"
+	"github.com/alterminal/member/repo"
+	"github.com/gin-gonic/gin"
+)
+
+func (a *Api) ListJobs(ctx *gin.Context) {
+	var query JobQuery
+	if !bindQuery(ctx, &query) {
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = 10
+	}
+	list, err := a.repos.Jobs.Search(ctx, repo.JobFilter{
+		Type:    query.Type,
+		Subject: query.Subject,
+		Status:  query.Status,
+	}, query.Limit, query.Page)
+	if err != nil {
+		abort(ctx, internalError(ctx, err))
+		return
+	}
+	ctx.JSON(200, list)
+}
+
+func (a *Api) jobOf(ctx *gin.Context) (*model.Job, bool) {
+	job, err := a.repos.Jobs.Get(ctx, ctx.Param("id"))
+	if err != nil {
+		abort(ctx, lookupError(ctx, err, "job"))
+		return nil, false
+	}
+	logWith(ctx, "job", job.ID)
+	return job, true
+}
+
+func (a *Api) GetJob(ctx *gin.Context) {
+	job, ok := a.jobOf(ctx)
+	if !ok {
+		return
+	}
+	ctx.JSON(200, job)
+}
+
+func (a *Api) RetryJob(ctx *gin.Context) {
+	job, ok := a.jobOf(ctx)
+	if !ok {
+		return
+	}
+	before := *job
+	err := a.scheduler.Retry(ctx, job)
+	if errors.Is(err, repo.ErrStale) {
+		abort(ctx, Conflict("job changed meanwhile, try again"))
+		return
+	}
+	if err != nil {
+		abort(ctx, internalError(ctx, err))
+		return
+	}
+	a.audit(ctx, model.AuditEntry{Action: "job.retry", TargetType: "job", TargetID: job.ID}, before, job)
+	ctx.JSON(202, job)
+}
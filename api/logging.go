@@ -0,0 +1,69 @@
+package api
+
+import (
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/alterminal/member/model"
+	"github.com/alterminal/member/tracing"
+	"github.com/gin-gonic/gin"
+)
+
+// requestId matches the request ids taken from clients. They end up in logs,
+// headers and the audit log, whose column holds 64 characters.
+var requestId = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID takes the X-Request-Id of the request, or generates one when it
+// is missing or not a plain id of at most 64 characters, and echoes it in
+// the response.
+func RequestID(ctx *gin.Context) {
+	id := ctx.GetHeader("X-Request-Id")
+	if !requestId.MatchString(id) {
+		id = model.NewID()
+	}
+	ctx.Set("requestId", id)
+	ctx.Header("X-Request-Id", id)
+}
+
+// Logger stores a request scoped logger in the context and writes one access
+// log line per request once it is handled.
+func Logger(logger *slog.Logger) func(ctx *gin.Context) {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		requestLogger := logger.With("requestId", ctx.GetString("requestId"))
+		if traceId := tracing.TraceID(ctx.Request.Context()); traceId != "" {
+			requestLogger = requestLogger.With("traceId", traceId)
+		}
+		ctx.Set("logger", requestLogger)
+		ctx.Next()
+		status := ctx.Writer.Status()
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		}
+		attrs := []any{
+			"method", ctx.Request.Method,
+			"route", ctx.FullPath(),
+			"path", ctx.Request.URL.Path,
+			"status", status,
+			"duration", time.Since(start),
+		}
+		if len(ctx.Errors) > 0 {
+			attrs = append(attrs, "error", ctx.Errors.String())
+		}
+		loggerOf(ctx).Log(ctx.Request.Context(), level, "request", attrs...)
+	}
+}
+
+func loggerOf(ctx *gin.Context) *slog.Logger {
+	if logger, ok := ctx.Get("logger"); ok {
+		return logger.(*slog.Logger)
+	}
+	return slog.Default()
+}
+
+// logWith adds fields to every later log line of the request.
+func logWith(ctx *gin.Context, args ...any) {
+	ctx.Set("logger", loggerOf(ctx).With(args...))
+}
@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestID(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		header string
+		kept   bool
+	}{
+		{"plain", "req-1.a_B", true},
+		{"64 characters", strings.Repeat("a", 64), true},
+		{"missing", "", false},
+		{"too long", strings.Repeat("a", 65), false},
+		{"spaces", "req 1", false},
+		{"control characters", "req\r\n1", false},
+		{"non ascii", "réq", false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(recorder)
+			ctx.Request = httptest.NewRequest("GET", "/", nil)
+			ctx.Request.Header.Set("X-Request-Id", test.header)
+			RequestID(ctx)
+			id := ctx.GetString("requestId")
+			if kept := id == test.header; kept != test.kept {
+				t.Errorf("request id = %q, want kept %t", id, test.kept)
+			}
+			if !requestId.MatchString(id) || recorder.Header().Get("X-Request-Id") != id {
+				t.Errorf("request id = %q, header = %q", id, recorder.Header().Get("X-Request-Id"))
+			}
+		})
+	}
+}
@@ -1,23 +1,38 @@
 package api
 
-type CreateSpaceRequest struct {
-	Name     string  `json:"name"`
-	ParentId *string `json:"parentId"`
+import (
+	"time"
+
+	"github.com/alterminal/member/model"
+)
+
+type PageQuery struct {
+	Limit int `form:"limit" json:"limit" binding:"omitempty,min=1,max=100"`
+	Page  int `form:"page" json:"page" binding:"min=0"`
 }
 
-type CreateConsumerRequest struct {
-	PhoneRegion string `json:"phoneRegion"`
-	PhoneNumber string `json:"phoneNumber"`
-	Password    string `json:"password"`
+type AuditQuery struct {
+	OrganizationId string    `form:"organizationId" json:"organizationId"`
+	ActorId        string    `form:"actorId" json:"actorId"`
+	Action         string    `form:"action" json:"action"`
+	TargetType     string    `form:"targetType" json:"targetType"`
+	TargetId       string    `form:"targetId" json:"targetId"`
+	Since          time.Time `form:"since" json:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until          time.Time `form:"until" json:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit          int       `form:"limit" json:"limit" binding:"omitempty,min=1,max=100"`
+	Page           int       `form:"page" json:"page" binding:"min=0"`
 }
 
-type CreateSubscriptionPlanRequest struct {
-	PaymentGateway string `json:"paymentGateway"`
-	PlanName       string `json:"planName"`
-	Currency       string `json:"currency"`
-	Price          int    `json:"price"`
+type JobQuery struct {
+	Type    string `form:"type" json:"type"`
+	Subject string `form:"subject" json:"subject"`
+	Status  string `form:"status" json:"status" binding:"omitempty,oneof=pending succeeded failed"`
+	Limit   int    `form:"limit" json:"limit" binding:"omitempty,min=1,max=100"`
+	Page    int    `form:"page" json:"page" binding:"min=0"`
 }
 
-type CancelSubscriptionRequest struct {
+// CreatedWebhook is the only response carrying the secret of a webhook.
+type CreatedWebhook struct {
+	model.Webhook
 	Secret string `json:"secret"`
 }
@@ -0,0 +1,49 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed openapi.yml
+var openapiYaml []byte
+
+var pathParam = regexp.MustCompile(`:(\w+)`)
+
+// OpenAPI returns the API document describing every route of the router.
+func OpenAPI() (map[string]any, error) {
+	var document map[string]any
+	if err := yaml.Unmarshal(openapiYaml, &document); err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+// UndocumentedRoutes lists the routes that have no operation in the document.
+func UndocumentedRoutes(document map[string]any, routes gin.RoutesInfo) []string {
+	paths, _ := document["paths"].(map[string]any)
+	var undocumented []string
+	for _, route := range routes {
+		// Preflight routes are added for every path by routeGroup.
+		if route.Method == http.MethodOptions {
+			continue
+		}
+		path := pathParam.ReplaceAllString(route.Path, "{$1}")
+		operations, _ := paths[path].(map[string]any)
+		if _, ok := operations[strings.ToLower(route.Method)]; !ok {
+			undocumented = append(undocumented, route.Method+" "+route.Path)
+		}
+	}
+	return undocumented
+}
+
+func serveOpenAPI(document map[string]any) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, document)
+	}
+}
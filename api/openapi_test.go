@@ -0,0 +1,259 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alterminal/member/accounts"
+	"github.com/alterminal/member/model"
+	"github.com/alterminal/member/repo"
+)
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	document, err := OpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := newTestRouter(repo.NewMemory(), accounts.NewMemory())
+	if undocumented := UndocumentedRoutes(document, router.Routes()); len(undocumented) != 0 {
+		t.Errorf("undocumented routes: %v", undocumented)
+	}
+}
+
+// TestOpenAPIResponses checks that responses of the router match the schemas
+// the document gives them.
+func TestOpenAPIResponses(t *testing.T) {
+	document, err := OpenAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repos := repo.NewMemory()
+	provider := accounts.NewMemory()
+	router := newTestRouter(repos, provider)
+	_, admin := createAccount(t, provider, "admin", "admin@example.com")
+	unknown := "0"
+
+	call := func(status int, method, route, path, token, body string) map[string]any {
+		t.Helper()
+		recorder := serve(router, method, path, token, body)
+		if recorder.Code != status {
+			t.Errorf("%s %s: status = %d, want %d: %s", method, path, recorder.Code, status, recorder.Body)
+		}
+		for _, problem := range checkResponse(document, method, route, recorder) {
+			t.Errorf("%s %s %d: %s", method, route, recorder.Code, problem)
+		}
+		var response map[string]any
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		return response
+	}
+
+	call(200, "GET", "/openapi.json", "/openapi.json", "", "")
+	call(200, "GET", "/healthz", "/healthz", "", "")
+	call(200, "GET", "/readyz", "/readyz", "", "")
+
+	tenant := call(201, "POST", "/tenants", "/tenants", admin, `{"email": "tenant@example.com", "password": "secret"}`)
+	tenantId, _ := tenant["id"].(string)
+	tenantToken := provider.IssueToken(tenantId)
+	call(409, "POST", "/tenants", "/tenants", admin, `{"email": "tenant@example.com", "password": "secret"}`)
+	call(400, "POST", "/tenants", "/tenants", admin, `{"email": "invalid"}`)
+	call(401, "POST", "/tenants", "/tenants", "", `{}`)
+	call(200, "GET", "/tenants", "/tenants", admin, "")
+	call(200, "GET", "/tenants/{id}", "/tenants/"+tenantId, admin, "")
+	call(404, "GET", "/tenants/{id}", "/tenants/"+unknown, admin, "")
+	call(204, "PUT", "/tenants/{id}/password", "/tenants/"+tenantId+"/password", admin, `{"password": "changed"}`)
+
+	organization := call(201, "POST", "/organizations", "/organizations", admin, `{"name": "organization"}`)
+	organizationId, _ := organization["id"].(string)
+	call(200, "GET", "/organizations/all", "/organizations/all", admin, "")
+	call(400, "GET", "/organizations/all", "/organizations/all?limit=1000", admin, "")
+	role := call(201, "POST", "/organizations/{id}/roles", "/organizations/"+organizationId+"/roles", admin, `{"name": "admin"}`)
+	roleId, _ := role["id"].(string)
+	call(200, "GET", "/organizations/{id}/roles", "/organizations/"+organizationId+"/roles", admin, "")
+	call(204, "POST", "/organizations/roles/{id}/account", "/organizations/roles/"+roleId+"/account", admin, `{"accountId": "`+tenantId+`"}`)
+	call(200, "GET", "/roles", "/roles", tenantToken, "")
+	call(200, "GET", "/organizations", "/organizations", tenantToken, "")
+	call(403, "GET", "/organizations", "/organizations", admin, "")
+
+	organizationPath := "/organizations/" + organizationId
+	call(200, "PUT", "/organizations/{id}/cors", organizationPath+"/cors", tenantToken, `{"origins": ["https://example.com"]}`)
+	call(200, "GET", "/organizations/{id}/audit", organizationPath+"/audit", tenantToken, "")
+	call(200, "GET", "/audit", "/audit", admin, "")
+	call(200, "GET", "/jobs", "/jobs", admin, "")
+	call(400, "GET", "/jobs", "/jobs?status=unknown", admin, "")
+	call(404, "GET", "/jobs/{id}", "/jobs/"+unknown, admin, "")
+
+	call(400, "POST", "/organizations/{id}/webhooks", organizationPath+"/webhooks", tenantToken, `{"url": "http://example.com/hook", "events": ["consumer.created"]}`)
+	webhook := call(201, "POST", "/organizations/{id}/webhooks", organizationPath+"/webhooks", tenantToken, `{"url": "https://example.com/hook", "events": ["consumer.created"]}`)
+	webhookId, _ := webhook["id"].(string)
+	call(200, "GET", "/organizations/{id}/webhooks", organizationPath+"/webhooks", tenantToken, "")
+	call(200, "GET", "/organizations/{id}/webhooks/{webhookId}/deliveries", organizationPath+"/webhooks/"+webhookId+"/deliveries", tenantToken, "")
+	call(400, "GET", "/organizations/{id}/webhooks/{webhookId}/deliveries", organizationPath+"/webhooks/"+webhookId+"/deliveries?limit=ten", tenantToken, "")
+	call(204, "DELETE", "/organizations/{id}/webhooks/{webhookId}", organizationPath+"/webhooks/"+webhookId, tenantToken, "")
+
+	space := call(201, "POST", "/organizations/{id}/spaces", organizationPath+"/spaces", tenantToken, `{"name": "space"}`)
+	spaceId, _ := space["id"].(string)
+	call(201, "POST", "/organizations/{id}/spaces", organizationPath+"/spaces", tenantToken, `{"name": "child", "parentId": "`+spaceId+`"}`)
+	call(200, "GET", "/organizations/{id}/spaces", organizationPath+"/spaces", tenantToken, "")
+	call(200, "PUT", "/spaces/{id}", "/spaces/"+spaceId, tenantToken, `{"name": "renamed"}`)
+	call(200, "GET", "/spaces/{id}/children", "/spaces/"+spaceId+"/children", tenantToken, "")
+	plan := call(201, "POST", "/spaces/{id}/subscriptionPlan", "/spaces/"+spaceId+"/subscriptionPlan", tenantToken, `{"paymentGateway": "stripe", "planName": "plan", "currency": "usd", "price": 100}`)
+	planId, _ := plan["id"].(string)
+	if err := repos.Subscriptions.Create(context.Background(), &model.Subscription{SubscriptionPlanId: planId, Status: model.SubscriptionActive}); err != nil {
+		t.Fatal(err)
+	}
+	call(200, "GET", "/spaces/{id}/entitlements", "/spaces/"+spaceId+"/entitlements", tenantToken, "")
+	call(200, "GET", "/spaces/{id}/subscriptionPlan", "/spaces/"+spaceId+"/subscriptionPlan", tenantToken, "")
+
+	call(201, "POST", "/organizations/{id}/consumers", organizationPath+"/consumers", tenantToken, `{"phoneRegion": "852", "phoneNumber": "91234567", "password": "secret"}`)
+	call(200, "GET", "/organizations/{id}/consumers", organizationPath+"/consumers", tenantToken, "")
+	call(403, "GET", "/organizations/{id}/consumers", organizationPath+"/consumers", admin, "")
+
+	call(204, "DELETE", "/organizations/roles/{id}", "/organizations/roles/"+roleId, admin, "")
+	call(204, "DELETE", "/tenants/{id}", "/tenants/"+tenantId, admin, "")
+}
+
+// checkResponse lists how the response differs from the one documented for
+// the route.
+func checkResponse(document map[string]any, method, route string, recorder *httptest.ResponseRecorder) []string {
+	operation, _ := lookup(document, "paths", route, strings.ToLower(method)).(map[string]any)
+	if operation == nil {
+		return []string{"operation is not documented"}
+	}
+	response, _ := lookup(operation, "responses", strconv.Itoa(recorder.Code)).(map[string]any)
+	if response == nil {
+		return []string{"status is not documented"}
+	}
+	response = resolve(document, response)
+	schema, _ := lookup(response, "content", "application/json", "schema").(map[string]any)
+	if schema == nil {
+		if recorder.Body.Len() != 0 {
+			return []string{"body is not documented"}
+		}
+		return nil
+	}
+	var body any
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		return []string{"body is not JSON: " + err.Error()}
+	}
+	return validate(document, schema, body, "body")
+}
+
+func lookup(value any, keys ...string) any {
+	for _, key := range keys {
+		object, _ := value.(map[string]any)
+		value = object[key]
+	}
+	return value
+}
+
+// resolve follows the $ref of schema to the component it names.
+func resolve(document, schema map[string]any) map[string]any {
+	for {
+		ref, ok := schema["$ref"].(string)
+		if !ok {
+			return schema
+		}
+		target, _ := lookup(document, strings.Split(strings.TrimPrefix(ref, "#/"), "/")...).(map[string]any)
+		schema = target
+	}
+}
+
+// merge folds the allOf of schema into one object schema.
+func merge(document, schema map[string]any) map[string]any {
+	members, ok := schema["allOf"].([]any)
+	if !ok {
+		return schema
+	}
+	properties := map[string]any{}
+	var required []any
+	for _, member := range members {
+		member := merge(document, resolve(document, member.(map[string]any)))
+		for name, property := range member["properties"].(map[string]any) {
+			properties[name] = property
+		}
+		memberRequired, _ := member["required"].([]any)
+		required = append(required, memberRequired...)
+	}
+	return map[string]any{"type": "object", "properties": properties, "required": required}
+}
+
+// validate checks value against the subset of JSON schema the document uses.
+// Objects with documented properties must not have undocumented ones.
+func validate(document, schema map[string]any, value any, path string) []string {
+	schema = merge(document, resolve(document, schema))
+	if value == nil {
+		if nullable, _ := schema["nullable"].(bool); nullable {
+			return nil
+		}
+		return []string{path + " is null"}
+	}
+	if enum, ok := schema["enum"].([]any); ok && !slices.Contains(enum, value) {
+		return []string{fmt.Sprintf("%s is %v, not one of %v", path, value, enum)}
+	}
+	var problems []string
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return []string{path + " is not an object"}
+		}
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				problems = append(problems, fmt.Sprintf("%s.%s is missing", path, name))
+			}
+		}
+		properties, ok := schema["properties"].(map[string]any)
+		if !ok {
+			return problems
+		}
+		for name, property := range object {
+			propertySchema, ok := properties[name].(map[string]any)
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s.%s is not documented", path, name))
+				continue
+			}
+			problems = append(problems, validate(document, propertySchema, property, path+"."+name)...)
+		}
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			return []string{path + " is not an array"}
+		}
+		items, _ := schema["items"].(map[string]any)
+		for i, item := range array {
+			problems = append(problems, validate(document, items, item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			return []string{path + " is not a string"}
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339, text); err != nil {
+				problems = append(problems, fmt.Sprintf("%s is not a date-time: %q", path, text))
+			}
+		}
+	case "integer":
+		number, ok := value.(float64)
+		if !ok || number != float64(int64(number)) {
+			return []string{path + " is not an integer"}
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return []string{path + " is not a number"}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return []string{path + " is not a boolean"}
+		}
+	}
+	return problems
+}
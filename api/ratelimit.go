@@ -0,0 +1,89 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	auth "github.com/alterminal/auth/model"
+	"github.com/alterminal/member/metrics"
+	"github.com/alterminal/member/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+var ErrTooManyRequests = NewError(http.StatusTooManyRequests, "too many requests")
+
+// RateLimit holds the limits of a route group per client IP, per
+// authenticated account and per organization owning the resource.
+type RateLimit struct {
+	IP           ratelimit.Limit
+	Account      ratelimit.Limit
+	Organization ratelimit.Limit
+}
+
+// RateLimiter enforces the limits of one route group. Its limits can be
+// replaced while serving.
+type RateLimiter struct {
+	group        string
+	store        ratelimit.Store
+	limits       atomic.Pointer[RateLimit]
+	organization func(ctx *gin.Context) string
+}
+
+func NewRateLimiter(group string, store ratelimit.Store, limits RateLimit) *RateLimiter {
+	l := &RateLimiter{group: group, store: store}
+	l.Set(limits)
+	return l
+}
+
+func (l *RateLimiter) Set(limits RateLimit) {
+	l.limits.Store(&limits)
+}
+
+// RateLimits holds the limiters of the public, tenant and admin route groups.
+type RateLimits struct {
+	Public *RateLimiter
+	Tenant *RateLimiter
+	Admin  *RateLimiter
+}
+
+func NewRateLimits(store ratelimit.Store, public, tenant, admin RateLimit) *RateLimits {
+	return &RateLimits{
+		Public: NewRateLimiter("public", store, public),
+		Tenant: NewRateLimiter("tenant", store, tenant),
+		Admin:  NewRateLimiter("admin", store, admin),
+	}
+}
+
+// Handle answers 429 with Retry-After once any bucket of the request is
+// empty. Requests are let through when the store fails.
+func (l *RateLimiter) Handle(ctx *gin.Context) {
+	limits := l.limits.Load()
+	check := func(kind, id string, limit ratelimit.Limit) bool {
+		if !limit.Enabled() || id == "" {
+			return true
+		}
+		ok, retryAfter, err := l.store.Take(ctx, l.group+":"+kind+":"+id, limit)
+		if err != nil {
+			loggerOf(ctx).Error("rate limit store failed", "error", err)
+			return true
+		}
+		if ok {
+			return true
+		}
+		metrics.RateLimited.WithLabelValues(l.group, kind).Inc()
+		ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		abort(ctx, ErrTooManyRequests)
+		return false
+	}
+	if !check("ip", ctx.ClientIP(), limits.IP) {
+		return
+	}
+	if account, ok := ctx.Get("account"); ok && !check("account", account.(auth.Account).ID, limits.Account) {
+		return
+	}
+	if limits.Organization.Enabled() && l.organization != nil {
+		check("organization", l.organization(ctx), limits.Organization)
+	}
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/alterminal/member/types"
+	"github.com/alterminal/member/webhook"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+var e164 = regexp.MustCompile(`^\+[1-9]\d{1,14}$`)
+
+func registerValidations() {
+	validate, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	// Stripe takes lower case codes, so the ISO 4217 check ignores case.
+	validate.RegisterValidation("currency", func(fl validator.FieldLevel) bool {
+		return validate.Var(strings.ToUpper(fl.Field().String()), "iso4217") == nil
+	})
+	validate.RegisterValidation("event", func(fl validator.FieldLevel) bool {
+		return slices.Contains(webhook.Events, fl.Field().String())
+	})
+	// Webhooks are only delivered over TLS.
+	validate.RegisterValidation("https", func(fl validator.FieldLevel) bool {
+		endpoint, err := url.Parse(fl.Field().String())
+		return err == nil && endpoint.Scheme == "https" && endpoint.Hostname() != ""
+	})
+	validate.RegisterValidation("origin", func(fl validator.FieldLevel) bool {
+		_, ok := origin(fl.Field().String())
+		return ok
+	})
+	validate.RegisterStructValidation(func(sl validator.StructLevel) {
+		request := sl.Current().Interface().(types.CreateConsumerRequest)
+		if !e164.MatchString("+" + request.PhoneRegion + request.PhoneNumber) {
+			sl.ReportError(request.PhoneNumber, "phoneNumber", "PhoneNumber", "e164", "")
+		}
+	}, types.CreateConsumerRequest{})
+}
+
+// origin returns value in the form browsers send in the Origin header:
+// lower case scheme and host, and the port only when it is not the default
+// one of the scheme. It reports false when value is not an http or https
+// origin, such as a URL with a path, query or fragment.
+func origin(value string) (string, bool) {
+	endpoint, err := url.Parse(value)
+	if err != nil || endpoint.Hostname() == "" || endpoint.User != nil || endpoint.Opaque != "" ||
+		(endpoint.Path != "" && endpoint.Path != "/") || endpoint.RawQuery != "" || endpoint.ForceQuery ||
+		endpoint.Fragment != "" || strings.Contains(value, "#") {
+		return "", false
+	}
+	scheme := strings.ToLower(endpoint.Scheme)
+	port := endpoint.Port()
+	switch {
+	case scheme != "http" && scheme != "https":
+		return "", false
+	case port == "" && strings.HasSuffix(endpoint.Host, ":"):
+		return "", false
+	case scheme == "http" && port == "80", scheme == "https" && port == "443":
+		port = ""
+	}
+	host := strings.ToLower(endpoint.Hostname())
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	return scheme + "://" + host, true
+}
+
+// bind decodes the JSON body into request and aborts with the failing fields
+// when it does not validate.
+func bind(ctx *gin.Context, request any) bool {
+	return validated(ctx, ctx.ShouldBindJSON(request))
+}
+
+// bindQuery is bind for the query string.
+func bindQuery(ctx *gin.Context, request any) bool {
+	return validated(ctx, ctx.ShouldBindQuery(request))
+}
+
+func validated(ctx *gin.Context, err error) bool {
+	if err == nil {
+		return true
+	}
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		abort(ctx, ErrInvalidRequest)
+		return false
+	}
+	response := *ErrInvalidRequest
+	for _, fieldError := range validationErrors {
+		response.Details = append(response.Details, FieldError{
+			Field:   fieldError.Field(),
+			Message: fieldMessage(fieldError),
+		})
+	}
+	abort(ctx, &response)
+	return false
+}
+
+func fieldMessage(fieldError validator.FieldError) string {
+	switch fieldError.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "max":
+		if fieldError.Kind() != reflect.String {
+			return "must be at most " + fieldError.Param()
+		}
+		return fmt.Sprintf("must be at most %s characters", fieldError.Param())
+	case "numeric":
+		return "must contain only digits"
+	case "oneof":
+		return "must be one of: " + fieldError.Param()
+	case "min":
+		return "must be at least " + fieldError.Param()
+	case "gte":
+		return "must be greater than or equal to " + fieldError.Param()
+	case "currency":
+		return "must be an ISO 4217 currency code"
+	case "event":
+		return "must be one of: " + strings.Join(webhook.Events, " ")
+	case "https":
+		return "must be an https URL"
+	case "origin":
+		return "must be an origin such as https://example.com"
+	case "e164":
+		return "must form an E.164 phone number with phoneRegion"
+	}
+	return "is invalid"
+}
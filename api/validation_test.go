@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/alterminal/member/accounts"
+	"github.com/alterminal/member/model"
+	"github.com/alterminal/member/repo"
+)
+
+func TestOrigin(t *testing.T) {
+	for _, test := range []struct {
+		value  string
+		origin string
+		ok     bool
+	}{
+		{"https://example.com", "https://example.com", true},
+		{"https://example.com/", "https://example.com", true},
+		{"HTTPS://Example.COM", "https://example.com", true},
+		{"http://localhost:3000", "http://localhost:3000", true},
+		{"https://example.com:443", "https://example.com", true},
+		{"http://example.com:80", "http://example.com", true},
+		{"https://example.com:8443", "https://example.com:8443", true},
+		{"http://[::1]:8080", "http://[::1]:8080", true},
+		{"https://example.com/path", "", false},
+		{"https://example.com?query", "", false},
+		{"https://example.com?", "", false},
+		{"https://example.com#fragment", "", false},
+		{"https://example.com#", "", false},
+		{"https://user@example.com", "", false},
+		{"https://example.com:", "", false},
+		{"ftp://example.com", "", false},
+		{"example.com", "", false},
+		{"https://", "", false},
+		{"", "", false},
+	} {
+		origin, ok := origin(test.value)
+		if origin != test.origin || ok != test.ok {
+			t.Errorf("origin(%q) = %q, %v, want %q, %v", test.value, origin, ok, test.origin, test.ok)
+		}
+	}
+}
+
+func TestSetAllowedOriginsValidation(t *testing.T) {
+	ctx := context.Background()
+	repos := repo.NewMemory()
+	provider := accounts.NewMemory()
+	router := newTestRouter(repos, provider)
+	tenant, token := createAccount(t, provider, "tenant", "tenant@example.com")
+	organization := model.Organization{Name: "organization"}
+	if err := repos.Organizations.Create(ctx, &organization); err != nil {
+		t.Fatal(err)
+	}
+	role := model.Role{OrganizationID: organization.ID, Name: "admin"}
+	if err := repos.Roles.Create(ctx, &role); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Roles.AddAccount(ctx, role.ID, tenant.ID); err != nil {
+		t.Fatal(err)
+	}
+	path := "/organizations/" + organization.ID + "/cors"
+
+	for _, body := range []string{
+		`{"origins": ["ftp://example.com"]}`,
+		`{"origins": ["https://example.com/path"]}`,
+	} {
+		recorder := serve(router, "PUT", path, token, body)
+		if recorder.Code != 400 {
+			t.Errorf("%s: status = %d, want 400", body, recorder.Code)
+			continue
+		}
+		var response Error
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		if len(response.Details) != 1 || response.Details[0].Field != "origins[0]" {
+			t.Errorf("%s: details = %+v", body, response.Details)
+		}
+	}
+
+	recorder := serve(router, "PUT", path, token, `{"origins": ["HTTPS://Example.com/", "https://example.com:443", "http://localhost:3000"]}`)
+	if recorder.Code != 200 {
+		t.Fatalf("status = %d: %s", recorder.Code, recorder.Body)
+	}
+	saved, err := repos.Organizations.Get(ctx, organization.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"https://example.com", "http://localhost:3000"}
+	if !slices.Equal(saved.AllowedOrigins, want) {
+		t.Errorf("allowed origins = %v, want %v", saved.AllowedOrigins, want)
+	}
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"github.com/alterminal/member/model"
+	"github.com/alterminal/member/types"
+	"github.com/alterminal/member/webhook"
+	"github.com/gin-gonic/gin"
+)
+
+func (a *Api) CreateWebhook(ctx *gin.Context) {
+	organization := ctx.MustGet("organization").(model.Organization)
+	var request types.CreateWebhookRequest
+	if !bind(ctx, &request) {
+		return
+	}
+	hook := model.Webhook{
+		OrganizationID: organization.ID,
+		URL:            request.URL,
+		Events:         request.Events,
+		Secret:         webhook.NewSecret(),
+	}
+	if err := a.repos.Webhooks.Create(ctx, &hook); err != nil {
+		abort(ctx, internalError(ctx, err))
+		return
+	}
+	logWith(ctx, "webhook", hook.ID)
+	a.audit(ctx, model.AuditEntry{Action: "webhook.create", OrganizationID: organization.ID, TargetType: "webhook", TargetID: hook.ID}, nil, hook)
+	ctx.JSON(201, CreatedWebhook{Webhook: hook, Secret: hook.Secret})
+}
+
+func (a *Api) ListWebhooks(ctx *gin.Context) {
+	organization := ctx.MustGet("organization").(model.Organization)
+	webhooks, err := a.repos.Webhooks.ListByOrganization(ctx, organization.ID)
+	if err != nil {
+		abort(ctx, internalError(ctx, err))
+		return
+	}
+	ctx.JSON(200, webhooks)
+}
+
+// webhookOf loads the webhook of the request, which must belong to the
+// organization of the request.
+func (a *Api) webhookOf(ctx *gin.Context) (*model.Webhook, bool) {
+	organization := ctx.MustGet("organization").(model.Organization)
+	hook, err := a.repos.Webhooks.Get(ctx, ctx.Param("webhookId"))
+	if err == nil && hook.OrganizationID != organization.ID {
+		abort(ctx, NotFound("webhook"))
+		return nil, false
+	}
+	if err != nil {
+		abort(ctx, lookupError(ctx, err, "webhook"))
+		return nil, false
+	}
+	logWith(ctx, "webhook", hook.ID)
+	return hook, true
+}
+
+func (a *Api) DeleteWebhook(ctx *gin.Context) {
+	hook, ok := a.webhookOf(ctx)
+	if !ok {
+		return
+	}
+	if err := a.repos.Webhooks.Delete(ctx, hook.ID); err != nil {
+		abort(ctx, lookupError(ctx, err, "webhook"))
+		return
+	}
+	a.audit(ctx, model.AuditEntry{Action: "webhook.delete", OrganizationID: hook.OrganizationID, TargetType: "webhook", TargetID: hook.ID}, hook, nil)
+	ctx.Status(204)
+}
+
+func (a *Api) ListWebhookDeliveries(ctx *gin.Context) {
+	hook, ok := a.webhookOf(ctx)
+	if !ok {
+		return
+	}
+	var query PageQuery
+	if !bindQuery(ctx, &query) {
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = 10
+	}
+	list, err := a.repos.WebhookDeliveries.ListByWebhook(ctx, hook.ID, query.Limit, query.Page)
+	if err != nil {
+		abort(ctx, internalError(ctx, err))
+		return
+	}
+	ctx.JSON(200, list)
+}
+
+func (a *Api) Redeliver(ctx *gin.Context) {
+	hook, ok := a.webhookOf(ctx)
+	if !ok {
+		return
+	}
+	delivery, err := a.repos.WebhookDeliveries.Get(ctx, ctx.Param("deliveryId"))
+	if err == nil && delivery.WebhookID != hook.ID {
+		abort(ctx, NotFound("delivery"))
+		return
+	}
+	if err != nil {
+		abort(ctx, lookupError(ctx, err, "delivery"))
+		return
+	}
+	redelivery, err := a.webhooks.Redeliver(ctx, delivery)
+	if err != nil {
+		abort(ctx, internalError(ctx, err))
+		return
+	}
+	a.audit(ctx, model.AuditEntry{Action: "webhook.redeliver", OrganizationID: hook.OrganizationID, TargetType: "webhookDelivery", TargetID: delivery.ID}, nil, nil)
+	ctx.JSON(202, redelivery)
+}
@@ -0,0 +1,382 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/alterminal/member/events"
+	"github.com/alterminal/member/jobs"
+	"github.com/alterminal/member/metrics"
+	"github.com/alterminal/member/model"
+	"github.com/alterminal/member/payment"
+	"github.com/alterminal/member/repo"
+)
+
+const (
+	Watch_interval     = 5 * time.Second
+	DefaultCheckoutTTL = 24 * time.Hour
+)
+
+var (
+	ErrSubscriptionExists = errors.New("subscription already exists")
+	ErrNotCompleted       = errors.New("subscription not completed")
+	ErrUnknownGateway     = errors.New("unknown payment gateway")
+	ErrGatewayFailed      = errors.New("payment gateway failed")
+)
+
+// SubscriptionEvent is the data of subscription events. It leaves out the
+// secret of the subscription.
+type SubscriptionEvent struct {
+	ID                 string     `json:"id"`
+	SubscriptionPlanId string     `json:"subscriptionPlanId"`
+	SpaceID            string     `json:"spaceId"`
+	Status             string     `json:"status"`
+	CreatedAt          time.Time  `json:"createdAt"`
+	CompletedAt        *time.Time `json:"completedAt"`
+	CanceledAt         *time.Time `json:"canceledAt"`
+	ExpiredAt          *time.Time `json:"expiredAt"`
+}
+
+// WatchJob polls the payment gateway for the subscription it is scheduled
+// for until the subscription is canceled or its checkout expired.
+const WatchJob = "subscription.watch"
+
+type Billing struct {
+	logger        *slog.Logger
+	interval      atomic.Int64
+	checkoutTTL   atomic.Int64
+	gateways      payment.Gateways
+	repos         repo.Repositories
+	spaces        repo.Spaces
+	plans         repo.SubscriptionPlans
+	subscriptions repo.Subscriptions
+	scheduler     *jobs.Scheduler
+}
+
+// New returns a Billing watching its subscriptions with jobs run by
+// scheduler.
+func New(repos repo.Repositories, gateways payment.Gateways, scheduler *jobs.Scheduler, logger *slog.Logger) *Billing {
+	b := &Billing{
+		logger:        logger,
+		gateways:      gateways,
+		repos:         repos,
+		spaces:        repos.Spaces,
+		plans:         repos.SubscriptionPlans,
+		subscriptions: repos.Subscriptions,
+		scheduler:     scheduler,
+	}
+	b.SetWatchInterval(Watch_interval)
+	b.SetCheckoutTTL(DefaultCheckoutTTL)
+	scheduler.Handle(WatchJob, b.Watch)
+	return b
+}
+
+// SetWatchInterval changes how often subscriptions are polled, starting with
+// their next poll.
+func (b *Billing) SetWatchInterval(interval time.Duration) {
+	b.interval.Store(int64(interval))
+}
+
+// SetCheckoutTTL changes how long a checkout stays open before it is
+// expired.
+func (b *Billing) SetCheckoutTTL(ttl time.Duration) {
+	b.checkoutTTL.Store(int64(ttl))
+}
+
+func (b *Billing) gateway(plan *model.SubscriptionPlan) (payment.PaymentGateway, error) {
+	gateway, ok := b.gateways[plan.PaymentGateway]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownGateway, plan.PaymentGateway)
+	}
+	return gateway, nil
+}
+
+// WatchPending schedules watch jobs for the subscriptions whose checkout is
+// still open and that have none, such as the ones created before jobs were.
+// A watch job that failed while its checkout is still open runs again, as a
+// type has only one job per subject and it would otherwise never be watched.
+func (b *Billing) WatchPending(ctx context.Context) error {
+	subscriptions, err := b.subscriptions.ListPending(ctx)
+	if err != nil {
+		return err
+	}
+	for _, subscription := range subscriptions {
+		if err := jobs.Schedule(ctx, b.repos.Jobs, WatchJob, subscription.ID, nil, time.Now()); err != nil {
+			return err
+		}
+		failed, err := b.repos.Jobs.Search(ctx, repo.JobFilter{Type: WatchJob, Subject: subscription.ID, Status: model.JobFailed}, 1, 0)
+		if err != nil {
+			return err
+		}
+		for _, job := range failed.Items {
+			b.logger.Warn("watching pending subscription again after its watch job failed", "subscription", subscription.ID, "job", job.ID, "error", job.Error)
+			if err := b.scheduler.Retry(ctx, job); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CreateSubscription opens a checkout for plan and returns the pending
+// subscription with the checkout the gateway opened for it.
+func (b *Billing) CreateSubscription(ctx context.Context, plan *model.SubscriptionPlan) (*model.Subscription, *payment.Subscription, error) {
+	active, err := b.subscriptions.ListActive(ctx, plan.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(active) > 0 {
+		return nil, nil, ErrSubscriptionExists
+	}
+	paymentGateway, err := b.gateway(plan)
+	if err != nil {
+		return nil, nil, err
+	}
+	// A checkout still open is handed out again rather than opening another
+	// one for the same plan.
+	pending, err := b.subscriptions.FindPending(ctx, plan.ID)
+	if err == nil {
+		sub, err := paymentGateway.RetrieveSubscription(ctx, pending.PaymentId)
+		if err != nil {
+			b.logger.Error("payment gateway failed", "space", plan.SpaceID, "plan", plan.ID, "gateway", plan.PaymentGateway, "error", err)
+			return nil, nil, err
+		}
+		return pending, sub, nil
+	}
+	if !errors.Is(err, repo.ErrNotFound) {
+		return nil, nil, err
+	}
+	sub, err := paymentGateway.CreateSubscription(ctx, plan.PlanName, plan.Price, plan.Currency)
+	if err != nil {
+		b.logger.Error("payment gateway failed", "space", plan.SpaceID, "plan", plan.ID, "gateway", plan.PaymentGateway, "error", err)
+		return nil, nil, err
+	}
+	subscription := model.Subscription{
+		SubscriptionPlanId: plan.ID,
+		Secret:             sub.ID,
+		PaymentId:          sub.ID,
+		Status:             model.SubscriptionPending,
+	}
+	err = b.commit(ctx, plan, &subscription, "created", func(tx repo.Repositories) error {
+		if err := tx.Subscriptions.Create(ctx, &subscription); err != nil {
+			return err
+		}
+		err := tx.Subscriptions.AddStatusChange(ctx, &model.SubscriptionStatusChange{
+			SubscriptionID: subscription.ID,
+			Status:         model.SubscriptionPending,
+		})
+		if err != nil {
+			return err
+		}
+		return jobs.Schedule(ctx, tx.Jobs, WatchJob, subscription.ID, nil, time.Now())
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	b.logger.Info("subscription created", "space", plan.SpaceID, "plan", plan.ID, "subscription", subscription.ID)
+	return &subscription, sub, nil
+}
+
+// Watch polls the payment gateway once for the subscription of job, moves
+// the subscription to the status the gateway reports and asks to run again
+// until the subscription ended.
+func (b *Billing) Watch(ctx context.Context, job *model.Job) error {
+	err := b.watch(ctx, job)
+	if errors.Is(err, repo.ErrStale) {
+		// The subscription changed meanwhile, such as canceled by its
+		// customer, so look at it again.
+		return jobs.Later(0)
+	}
+	return err
+}
+
+func (b *Billing) watch(ctx context.Context, job *model.Job) error {
+	subscription, err := b.subscriptions.Get(ctx, job.Subject)
+	if err != nil {
+		return err
+	}
+	if subscription.Ended() {
+		return nil
+	}
+	plan, err := b.plans.Get(ctx, subscription.SubscriptionPlanId)
+	if err != nil {
+		return err
+	}
+	paymentGateway, err := b.gateway(plan)
+	if err != nil {
+		return err
+	}
+	sub, err := paymentGateway.RetrieveSubscription(ctx, subscription.PaymentId)
+	if err != nil {
+		return err
+	}
+	if sub.Status != subscription.Status {
+		err := b.transition(ctx, plan, subscription, sub.Status)
+		if errors.Is(err, ErrSubscriptionExists) {
+			return b.cancelDuplicate(ctx, plan, paymentGateway, subscription)
+		}
+		if errors.Is(err, model.ErrInvalidTransition) {
+			b.logger.Warn("ignored status reported by payment gateway", "subscription", subscription.ID, "error", err)
+		} else if err != nil {
+			return err
+		}
+		if subscription.Ended() {
+			return nil
+		}
+	}
+	if subscription.Status == model.SubscriptionPending && time.Since(subscription.CreatedAt) > time.Duration(b.checkoutTTL.Load()) {
+		return b.expire(ctx, plan, paymentGateway, subscription)
+	}
+	return jobs.Later(time.Duration(b.interval.Load()))
+}
+
+// expire ends the checkout of a subscription that was not paid in time.
+func (b *Billing) expire(ctx context.Context, plan *model.SubscriptionPlan, paymentGateway payment.PaymentGateway, subscription *model.Subscription) error {
+	if err := paymentGateway.CancelPayment(ctx, subscription.PaymentId); err != nil {
+		return err
+	}
+	return b.transition(ctx, plan, subscription, model.SubscriptionExpired)
+}
+
+// cancelDuplicate ends a subscription whose checkout was paid while its plan
+// already had a live subscription, so the customer is not billed twice. A
+// row sharing the checkout of the live subscription is only a second record
+// of the same payment, so only the row is ended then.
+func (b *Billing) cancelDuplicate(ctx context.Context, plan *model.SubscriptionPlan, paymentGateway payment.PaymentGateway, subscription *model.Subscription) error {
+	logger := b.logger.With("space", plan.SpaceID, "plan", plan.ID, "subscription", subscription.ID)
+	active, err := b.subscriptions.ListActive(ctx, plan.ID)
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(active, func(live *model.Subscription) bool { return live.PaymentId == subscription.PaymentId }) {
+		logger.Warn("subscription records the checkout of the live one, ending it")
+	} else {
+		logger.Warn("plan already has a live subscription, canceling the payment of another")
+		if err := paymentGateway.CancelPayment(ctx, subscription.PaymentId); err != nil {
+			return err
+		}
+	}
+	return b.transition(ctx, plan, subscription, model.SubscriptionCanceled)
+}
+
+// transition moves subscription to status, unless the state machine forbids
+// it, and records the change in its history. subscription is only changed
+// once the change is committed. It returns repo.ErrStale when the
+// subscription changed since it was read.
+func (b *Billing) transition(ctx context.Context, plan *model.SubscriptionPlan, subscription *model.Subscription, status string) error {
+	next := *subscription
+	previous := next.Status
+	if err := next.Transition(status); err != nil {
+		return err
+	}
+	err := b.commit(ctx, plan, &next, eventOf(previous, status), func(tx repo.Repositories) error {
+		if previous == model.SubscriptionPending && !next.Ended() {
+			active, err := tx.Subscriptions.ListActive(ctx, subscription.SubscriptionPlanId)
+			if err != nil {
+				return err
+			}
+			if len(active) > 0 {
+				return ErrSubscriptionExists
+			}
+		}
+		if err := tx.Subscriptions.Save(ctx, &next); err != nil {
+			return err
+		}
+		return tx.Subscriptions.AddStatusChange(ctx, &model.SubscriptionStatusChange{
+			SubscriptionID: next.ID,
+			Previous:       previous,
+			Status:         status,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	*subscription = next
+	b.logger.Info("subscription status changed", "space", plan.SpaceID, "plan", plan.ID, "subscription", subscription.ID, "previous", previous, "status", status)
+	return nil
+}
+
+// eventOf names the subscription event of a change from previous to status.
+func eventOf(previous, status string) string {
+	switch {
+	case status == model.SubscriptionCanceled:
+		return "canceled"
+	case status == model.SubscriptionExpired:
+		return "expired"
+	case previous == model.SubscriptionPending:
+		return "completed"
+	}
+	return "status.changed"
+}
+
+// commit runs write and records the subscription event in one transaction,
+// then counts the event.
+func (b *Billing) commit(ctx context.Context, plan *model.SubscriptionPlan, subscription *model.Subscription, event string, write func(tx repo.Repositories) error) error {
+	space, err := b.spaces.Get(ctx, plan.SpaceID)
+	if err != nil {
+		return err
+	}
+	err = b.repos.Transaction(ctx, func(tx repo.Repositories) error {
+		if err := write(tx); err != nil {
+			return err
+		}
+		return events.Record(ctx, tx.Outbox, "subscription."+event, space.OrganizationID, SubscriptionEvent{
+			ID:                 subscription.ID,
+			SubscriptionPlanId: subscription.SubscriptionPlanId,
+			SpaceID:            plan.SpaceID,
+			Status:             subscription.Status,
+			CreatedAt:          subscription.CreatedAt,
+			CompletedAt:        subscription.CompletedAt,
+			CanceledAt:         subscription.CanceledAt,
+			ExpiredAt:          subscription.ExpiredAt,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	metrics.Subscriptions.WithLabelValues(plan.PaymentGateway, event).Inc()
+	return nil
+}
+
+// Cancel cancels subscription at the payment gateway and then here. When the
+// gateway fails it returns ErrGatewayFailed and leaves subscription as it
+// was, so the cancellation can be tried again.
+func (b *Billing) Cancel(ctx context.Context, subscription *model.Subscription) error {
+	if subscription.Status == model.SubscriptionPending {
+		return ErrNotCompleted
+	}
+	plan, err := b.plans.Get(ctx, subscription.SubscriptionPlanId)
+	if err != nil {
+		return err
+	}
+	paymentGateway, err := b.gateway(plan)
+	if err != nil {
+		return err
+	}
+	logger := b.logger.With("space", plan.SpaceID, "plan", plan.ID, "subscription", subscription.ID)
+	if err := paymentGateway.CancelSubscription(ctx, subscription.PaymentId); err != nil {
+		logger.Error("payment gateway cancel failed", "error", err)
+		return fmt.Errorf("%w: %w", ErrGatewayFailed, err)
+	}
+	for {
+		err := b.transition(ctx, plan, subscription, model.SubscriptionCanceled)
+		if !errors.Is(err, repo.ErrStale) {
+			return err
+		}
+		// The watch job changed the subscription meanwhile, so cancel the
+		// subscription as it is now.
+		fresh, err := b.subscriptions.Get(ctx, subscription.ID)
+		if err != nil {
+			return err
+		}
+		*subscription = *fresh
+		if subscription.Status == model.SubscriptionCanceled {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/alterminal/member/jobs"
+	"github.com/alterminal/member/lease"
+	"github.com/alterminal/member/model"
+	"github.com/alterminal/member/payment"
+	"github.com/alterminal/member/repo"
+)
+
+type fakeGateway struct {
+	status                string
+	cancelErr             error
+	cancelPaymentErr      error
+	canceledPayment       []string
+	canceledSubscriptions []string
+}
+
+func (g *fakeGateway) CreateSubscription(ctx context.Context, itemName string, price int, currency string) (*payment.Subscription, error) {
+	return &payment.Subscription{ID: model.NewID()}, nil
+}
+
+func (g *fakeGateway) CancelSubscription(ctx context.Context, subscriptionId string) error {
+	if g.cancelErr != nil {
+		return g.cancelErr
+	}
+	g.canceledSubscriptions = append(g.canceledSubscriptions, subscriptionId)
+	return nil
+}
+
+func (g *fakeGateway) RetrieveSubscription(ctx context.Context, subscriptionId string) (*payment.Subscription, error) {
+	return &payment.Subscription{ID: subscriptionId, Status: g.status}, nil
+}
+
+func (g *fakeGateway) CancelPayment(ctx context.Context, subscriptionId string) error {
+	if g.cancelPaymentErr != nil {
+		return g.cancelPaymentErr
+	}
+	g.canceledPayment = append(g.canceledPayment, subscriptionId)
+	return nil
+}
+
+func newBilling(t *testing.T, gateway payment.PaymentGateway) (*Billing, repo.Repositories, *model.SubscriptionPlan) {
+	t.Helper()
+	ctx := context.Background()
+	repos := repo.NewMemory()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	leases := lease.New(ctx, repos.Leases, time.Minute, logger)
+	scheduler := jobs.New(ctx, repos.Jobs, jobs.Config{Workers: 1}, leases, logger)
+	space := model.Space{OrganizationID: model.NewID(), Name: "space"}
+	if err := repos.Spaces.Create(ctx, &space); err != nil {
+		t.Fatal(err)
+	}
+	plan := model.SubscriptionPlan{SpaceID: space.ID, PaymentGateway: "fake", PlanName: "plan", Currency: "usd", Price: 100}
+	if err := repos.SubscriptionPlans.Create(ctx, &plan); err != nil {
+		t.Fatal(err)
+	}
+	return New(repos, payment.Gateways{"fake": gateway}, scheduler, logger), repos, &plan
+}
+
+func createSubscription(t *testing.T, repos repo.Repositories, plan *model.SubscriptionPlan, status string) *model.Subscription {
+	t.Helper()
+	subscription := model.Subscription{SubscriptionPlanId: plan.ID, PaymentId: model.NewID(), Status: status}
+	if err := repos.Subscriptions.Create(context.Background(), &subscription); err != nil {
+		t.Fatal(err)
+	}
+	return &subscription
+}
+
+func TestCancelGatewayFailure(t *testing.T) {
+	ctx := context.Background()
+	gateway := &fakeGateway{cancelErr: errors.New("unavailable")}
+	billing, repos, plan := newBilling(t, gateway)
+	subscription := createSubscription(t, repos, plan, model.SubscriptionActive)
+	if err := billing.Cancel(ctx, subscription); !errors.Is(err, ErrGatewayFailed) {
+		t.Fatalf("err = %v, want ErrGatewayFailed", err)
+	}
+	if subscription.Status != model.SubscriptionActive || subscription.CanceledAt != nil {
+		t.Errorf("subscription = %s canceled at %v, want unchanged", subscription.Status, subscription.CanceledAt)
+	}
+	stored, err := repos.Subscriptions.Get(ctx, subscription.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != model.SubscriptionActive {
+		t.Errorf("stored status = %s, want active", stored.Status)
+	}
+
+	gateway.cancelErr = nil
+	if err := billing.Cancel(ctx, subscription); err != nil {
+		t.Fatal(err)
+	}
+	if subscription.Status != model.SubscriptionCanceled {
+		t.Errorf("status = %s, want canceled", subscription.Status)
+	}
+}
+
+func TestWatchCancelsDuplicatePayment(t *testing.T) {
+	ctx := context.Background()
+	gateway := &fakeGateway{status: model.SubscriptionActive}
+	billing, repos, plan := newBilling(t, gateway)
+	createSubscription(t, repos, plan, model.SubscriptionActive)
+	duplicate := createSubscription(t, repos, plan, model.SubscriptionPending)
+
+	if err := billing.Watch(ctx, &model.Job{Type: WatchJob, Subject: duplicate.ID}); err != nil {
+		t.Fatalf("err = %v, want the job to finish", err)
+	}
+	if len(gateway.canceledPayment) != 1 || gateway.canceledPayment[0] != duplicate.PaymentId {
+		t.Errorf("canceled payments = %v, want %s", gateway.canceledPayment, duplicate.PaymentId)
+	}
+	stored, err := repos.Subscriptions.Get(ctx, duplicate.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != model.SubscriptionCanceled || stored.CompletedAt != nil {
+		t.Errorf("stored = %s completed at %v, want canceled and never completed", stored.Status, stored.CompletedAt)
+	}
+}
+
+func TestCreateSubscriptionReusesOpenCheckout(t *testing.T) {
+	ctx := context.Background()
+	gateway := &fakeGateway{status: model.SubscriptionPending}
+	billing, repos, plan := newBilling(t, gateway)
+	subscription, first, err := billing.CreateSubscription(ctx, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, second, err := billing.CreateSubscription(ctx, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != subscription.ID || second.ID != first.ID {
+		t.Errorf("second checkout = %s of %s, want %s of %s", second.ID, again.ID, first.ID, subscription.ID)
+	}
+	pending, err := repos.Subscriptions.ListPending(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 {
+		t.Fatalf("pending subscriptions = %d, want 1", len(pending))
+	}
+	// A row recording the same checkout, as created before checkouts were
+	// reused, must not cancel the payment when the checkout completes.
+	legacy := model.Subscription{SubscriptionPlanId: plan.ID, PaymentId: first.ID, Status: model.SubscriptionPending}
+	if err := repos.Subscriptions.Create(ctx, &legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	gateway.status = model.SubscriptionActive
+	for _, id := range []string{pending[0].ID, legacy.ID} {
+		if err := billing.Watch(ctx, &model.Job{Type: WatchJob, Subject: id}); err != nil && !isLater(err) {
+			t.Fatal(err)
+		}
+	}
+	if len(gateway.canceledPayment) != 0 || len(gateway.canceledSubscriptions) != 0 {
+		t.Errorf("canceled payments %v and subscriptions %v, want none", gateway.canceledPayment, gateway.canceledSubscriptions)
+	}
+	for id, status := range map[string]string{pending[0].ID: model.SubscriptionActive, legacy.ID: model.SubscriptionCanceled} {
+		stored, err := repos.Subscriptions.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Status != status {
+			t.Errorf("subscription %s = %s, want %s", id, stored.Status, status)
+		}
+	}
+}
+
+// isLater reports whether err asks to watch the subscription again.
+func isLater(err error) bool {
+	return err.Error() == jobs.Later(Watch_interval).Error()
+}
+
+func TestTransitionStale(t *testing.T) {
+	ctx := context.Background()
+	gateway := &fakeGateway{status: model.SubscriptionPastDue}
+	billing, repos, plan := newBilling(t, gateway)
+	subscription := createSubscription(t, repos, plan, model.SubscriptionActive)
+	watched := *subscription
+	if err := billing.Cancel(ctx, subscription); err != nil {
+		t.Fatal(err)
+	}
+	if err := billing.transition(ctx, plan, &watched, model.SubscriptionPastDue); !errors.Is(err, repo.ErrStale) {
+		t.Fatalf("err = %v, want ErrStale", err)
+	}
+	if watched.Status != model.SubscriptionActive {
+		t.Errorf("watched status = %s, want active", watched.Status)
+	}
+	stored, err := repos.Subscriptions.Get(ctx, subscription.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != model.SubscriptionCanceled {
+		t.Errorf("stored status = %s, want canceled", stored.Status)
+	}
+}
+
+func TestCancelAfterWatch(t *testing.T) {
+	ctx := context.Background()
+	gateway := &fakeGateway{status: model.SubscriptionPastDue}
+	billing, repos, plan := newBilling(t, gateway)
+	subscription := createSubscription(t, repos, plan, model.SubscriptionActive)
+	canceled := *subscription
+	if err := billing.Watch(ctx, &model.Job{Type: WatchJob, Subject: subscription.ID}); !isLater(err) {
+		t.Fatalf("err = %v, want to watch again", err)
+	}
+	if err := billing.Cancel(ctx, &canceled); err != nil {
+		t.Fatal(err)
+	}
+	if canceled.Status != model.SubscriptionCanceled {
+		t.Errorf("status = %s, want canceled", canceled.Status)
+	}
+}
+
+func TestWatchExpiresCheckout(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		name      string
+		cancelErr error
+		status    string
+	}{
+		{"expired", nil, model.SubscriptionExpired},
+		{"gateway failure", errors.New("unavailable"), model.SubscriptionPending},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			gateway := &fakeGateway{status: model.SubscriptionPending, cancelPaymentErr: test.cancelErr}
+			billing, repos, plan := newBilling(t, gateway)
+			billing.SetCheckoutTTL(time.Hour)
+			subscription := createSubscription(t, repos, plan, model.SubscriptionPending)
+			subscription.CreatedAt = time.Now().Add(-2 * time.Hour)
+			if err := repos.Subscriptions.Save(ctx, subscription); err != nil {
+				t.Fatal(err)
+			}
+
+			err := billing.Watch(ctx, &model.Job{Type: WatchJob, Subject: subscription.ID})
+			if test.cancelErr != nil {
+				if !errors.Is(err, test.cancelErr) {
+					t.Errorf("err = %v, want the gateway error to retry the job", err)
+				}
+			} else {
+				if err != nil {
+					t.Errorf("err = %v, want the job to finish", err)
+				}
+				if len(gateway.canceledPayment) != 1 || gateway.canceledPayment[0] != subscription.PaymentId {
+					t.Errorf("canceled payments = %v, want %s", gateway.canceledPayment, subscription.PaymentId)
+				}
+			}
+			stored, err := repos.Subscriptions.Get(ctx, subscription.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Status != test.status {
+				t.Errorf("status = %s, want %s", stored.Status, test.status)
+			}
+			if expired := stored.ExpiredAt != nil; expired != (test.status == model.SubscriptionExpired) {
+				t.Errorf("expired at = %v", stored.ExpiredAt)
+			}
+		})
+	}
+}
+
+func TestWatchKeepsFreshCheckout(t *testing.T) {
+	gateway := &fakeGateway{status: model.SubscriptionPending}
+	billing, repos, plan := newBilling(t, gateway)
+	billing.SetCheckoutTTL(time.Hour)
+	subscription := createSubscription(t, repos, plan, model.SubscriptionPending)
+	if err := billing.Watch(context.Background(), &model.Job{Type: WatchJob, Subject: subscription.ID}); !isLater(err) {
+		t.Errorf("err = %v, want to watch again", err)
+	}
+	if len(gateway.canceledPayment) != 0 {
+		t.Errorf("canceled payments = %v, want none", gateway.canceledPayment)
+	}
+}
+
+func TestWatchPendingRetriesFailedJob(t *testing.T) {
+	ctx := context.Background()
+	billing, repos, plan := newBilling(t, &fakeGateway{})
+	subscription := createSubscription(t, repos, plan, model.SubscriptionPending)
+	job := model.Job{Type: WatchJob, Subject: subscription.ID, Status: model.JobFailed, Attempts: 5, Error: "unavailable"}
+	if _, err := repos.Jobs.Add(ctx, &job); err != nil {
+		t.Fatal(err)
+	}
+	if err := billing.WatchPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := repos.Jobs.Get(ctx, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != model.JobPending || stored.Attempts != 0 || stored.RunAt == nil {
+		t.Errorf("job = %s after %d attempts run at %v, want pending", stored.Status, stored.Attempts, stored.RunAt)
+	}
+}
@@ -0,0 +1,169 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/alterminal/member/client"
+	"golang.org/x/term"
+)
+
+var ErrUsage = errors.New("usage")
+
+type command struct {
+	usage string
+	run   func(e *env, args []string) error
+}
+
+var commands = map[string]map[string]command{
+	"tenants": tenantCommands,
+	"orgs":    organizationCommands,
+	"roles":   roleCommands,
+	"spaces":  spaceCommands,
+}
+
+// IsCommand reports whether name is a command group handled by Run.
+func IsCommand(name string) bool {
+	_, ok := commands[name]
+	return ok
+}
+
+// Run executes a command such as "orgs list" against the member API. The
+// service URL and token come from -url and -token or MEMBER_URL and
+// MEMBER_TOKEN. Passwords come from MEMBER_PASSWORD or stdin.
+func Run(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) < 2 {
+		usage(stdout)
+		return ErrUsage
+	}
+	group, ok := commands[args[0]]
+	if !ok {
+		usage(stdout)
+		return ErrUsage
+	}
+	cmd, ok := group[args[1]]
+	if !ok {
+		usage(stdout)
+		return ErrUsage
+	}
+	e := &env{
+		ctx:    ctx,
+		name:   args[0] + " " + args[1],
+		usage:  cmd.usage,
+		client: &client.Client{},
+		stdin:  stdin,
+		stdout: stdout,
+	}
+	return cmd.run(e, args[2:])
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: member <command> [flags] [args]")
+	var lines []string
+	for groupName, group := range commands {
+		for name, cmd := range group {
+			lines = append(lines, strings.TrimRight(fmt.Sprintf("  %s %s %s", groupName, name, cmd.usage), " "))
+		}
+	}
+	sort.Strings(lines)
+	fmt.Fprintln(w, strings.Join(lines, "\n"))
+	fmt.Fprintln(w, "flags: -url URL (MEMBER_URL) -token TOKEN (MEMBER_TOKEN) -o table|json")
+}
+
+type env struct {
+	ctx    context.Context
+	name   string
+	usage  string
+	client *client.Client
+	output string
+	stdin  io.Reader
+	stdout io.Writer
+}
+
+func getenv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// parse parses the common flags plus the ones added by define and checks
+// that exactly n positional arguments remain.
+func (e *env) parse(args []string, n int, define func(fs *flag.FlagSet)) ([]string, error) {
+	fs := flag.NewFlagSet(e.name, flag.ContinueOnError)
+	fs.SetOutput(e.stdout)
+	fs.StringVar(&e.client.BaseUrl, "url", getenv("MEMBER_URL", "http://localhost:8080"), "member service URL")
+	fs.StringVar(&e.client.AccessToken, "token", os.Getenv("MEMBER_TOKEN"), "bearer token")
+	fs.StringVar(&e.output, "o", "table", "output format: table or json")
+	if define != nil {
+		define(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != n {
+		fmt.Fprintf(e.stdout, "usage: member %s %s\n", e.name, e.usage)
+		return nil, ErrUsage
+	}
+	return fs.Args(), nil
+}
+
+// print writes value as JSON or as a table of rows under header.
+func (e *env) print(value any, header []string, rows [][]string) error {
+	if e.output == "json" {
+		encoder := json.NewEncoder(e.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	}
+	w := tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// password reads a password from MEMBER_PASSWORD or else the first line of
+// stdin, prompting without echo when stdin is a terminal.
+func (e *env) password(prompt string) (string, error) {
+	if password := os.Getenv("MEMBER_PASSWORD"); password != "" {
+		return password, nil
+	}
+	var password string
+	if file, ok := e.stdin.(*os.File); ok && term.IsTerminal(int(file.Fd())) {
+		fmt.Fprint(os.Stderr, prompt)
+		buf, err := term.ReadPassword(int(file.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		password = string(buf)
+	} else {
+		line, err := bufio.NewReader(e.stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if password == "" {
+		return "", errors.New("password required on stdin or in MEMBER_PASSWORD")
+	}
+	return password, nil
+}
+
+func (e *env) done(format string, args ...any) error {
+	if e.output == "json" {
+		return nil
+	}
+	_, err := fmt.Fprintf(e.stdout, format+"\n", args...)
+	return err
+}
@@ -0,0 +1,296 @@
+package cli
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/alterminal/member/types"
+)
+
+var accountHeader = []string{"ID", "NAMESPACE", "EMAIL", "PHONE"}
+
+func accountRows(accounts ...types.Account) [][]string {
+	rows := make([][]string, len(accounts))
+	for i, account := range accounts {
+		phone := ""
+		if account.PhoneNumber != "" {
+			phone = "+" + account.PhoneRegion + " " + account.PhoneNumber
+		}
+		rows[i] = []string{account.ID, account.Namespace, account.Email, phone}
+	}
+	return rows
+}
+
+var organizationHeader = []string{"ID", "NAME"}
+
+func organizationRows(organizations ...types.Organization) [][]string {
+	rows := make([][]string, len(organizations))
+	for i, organization := range organizations {
+		rows[i] = []string{organization.ID, organization.Name}
+	}
+	return rows
+}
+
+var roleHeader = []string{"ID", "ORGANIZATION", "NAME"}
+
+func roleRows(roles ...types.Role) [][]string {
+	rows := make([][]string, len(roles))
+	for i, role := range roles {
+		rows[i] = []string{role.ID, role.OrganizationID, role.Name}
+	}
+	return rows
+}
+
+var spaceHeader = []string{"ID", "PARENT", "NAME"}
+
+func spaceRows(spaces ...types.Space) [][]string {
+	rows := make([][]string, len(spaces))
+	for i, space := range spaces {
+		parent := ""
+		if space.ParentId != nil {
+			parent = *space.ParentId
+		}
+		rows[i] = []string{space.ID, parent, space.Name}
+	}
+	return rows
+}
+
+var tenantCommands = map[string]command{
+	"list": {"", func(e *env, args []string) error {
+		if _, err := e.parse(args, 0, nil); err != nil {
+			return err
+		}
+		tenants, err := e.client.ListTenants(e.ctx)
+		if err != nil {
+			return err
+		}
+		return e.print(tenants, accountHeader, accountRows(tenants...))
+	}},
+	"get": {"ID", func(e *env, args []string) error {
+		args, err := e.parse(args, 1, nil)
+		if err != nil {
+			return err
+		}
+		tenant, err := e.client.GetTenant(e.ctx, args[0])
+		if err != nil {
+			return err
+		}
+		return e.print(tenant, accountHeader, accountRows(*tenant))
+	}},
+	"create": {"-email EMAIL", func(e *env, args []string) error {
+		var email string
+		if _, err := e.parse(args, 0, func(fs *flag.FlagSet) {
+			fs.StringVar(&email, "email", "", "tenant email")
+		}); err != nil {
+			return err
+		}
+		password, err := e.password("Password: ")
+		if err != nil {
+			return err
+		}
+		tenant, err := e.client.CreateTenant(e.ctx, email, password)
+		if err != nil {
+			return err
+		}
+		return e.print(tenant, accountHeader, accountRows(*tenant))
+	}},
+	"delete": {"ID", func(e *env, args []string) error {
+		args, err := e.parse(args, 1, nil)
+		if err != nil {
+			return err
+		}
+		if err := e.client.DeleteTenant(e.ctx, args[0]); err != nil {
+			return err
+		}
+		return e.done("deleted tenant %s", args[0])
+	}},
+	"set-password": {"ID", func(e *env, args []string) error {
+		args, err := e.parse(args, 1, nil)
+		if err != nil {
+			return err
+		}
+		password, err := e.password("New password: ")
+		if err != nil {
+			return err
+		}
+		if err := e.client.SetTenantPassword(e.ctx, args[0], password); err != nil {
+			return err
+		}
+		return e.done("password of tenant %s updated", args[0])
+	}},
+}
+
+var organizationCommands = map[string]command{
+	"list": {"[-limit N]", func(e *env, args []string) error {
+		var limit int
+		if _, err := e.parse(args, 0, func(fs *flag.FlagSet) {
+			fs.IntVar(&limit, "limit", 50, "organizations per request")
+		}); err != nil {
+			return err
+		}
+		organizations := make([]types.Organization, 0)
+		it := e.client.AllOrganizations(e.ctx, limit)
+		for it.Next() {
+			organizations = append(organizations, *it.Item())
+		}
+		if err := it.Err(); err != nil {
+			return err
+		}
+		return e.print(organizations, organizationHeader, organizationRows(organizations...))
+	}},
+	"mine": {"", func(e *env, args []string) error {
+		if _, err := e.parse(args, 0, nil); err != nil {
+			return err
+		}
+		organizations, err := e.client.ListMyOrganizations(e.ctx)
+		if err != nil {
+			return err
+		}
+		return e.print(organizations, organizationHeader, organizationRows(organizations...))
+	}},
+	"create": {"NAME", func(e *env, args []string) error {
+		args, err := e.parse(args, 1, nil)
+		if err != nil {
+			return err
+		}
+		organization, err := e.client.CreateOrganization(e.ctx, args[0])
+		if err != nil {
+			return err
+		}
+		return e.print(organization, organizationHeader, organizationRows(*organization))
+	}},
+}
+
+var roleCommands = map[string]command{
+	"list": {"ORGANIZATION_ID", func(e *env, args []string) error {
+		args, err := e.parse(args, 1, nil)
+		if err != nil {
+			return err
+		}
+		roles, err := e.client.ListRoles(e.ctx, args[0])
+		if err != nil {
+			return err
+		}
+		return e.print(roles, roleHeader, roleRows(roles...))
+	}},
+	"mine": {"", func(e *env, args []string) error {
+		if _, err := e.parse(args, 0, nil); err != nil {
+			return err
+		}
+		roles, err := e.client.ListMyRoles(e.ctx)
+		if err != nil {
+			return err
+		}
+		return e.print(roles, roleHeader, roleRows(roles...))
+	}},
+	"create": {"ORGANIZATION_ID NAME", func(e *env, args []string) error {
+		args, err := e.parse(args, 2, nil)
+		if err != nil {
+			return err
+		}
+		role, err := e.client.CreateRole(e.ctx, args[0], args[1])
+		if err != nil {
+			return err
+		}
+		return e.print(role, roleHeader, roleRows(*role))
+	}},
+	"delete": {"ROLE_ID", func(e *env, args []string) error {
+		args, err := e.parse(args, 1, nil)
+		if err != nil {
+			return err
+		}
+		if err := e.client.DeleteRole(e.ctx, args[0]); err != nil {
+			return err
+		}
+		return e.done("deleted role %s", args[0])
+	}},
+	"assign": {"ROLE_ID ACCOUNT_ID", func(e *env, args []string) error {
+		args, err := e.parse(args, 2, nil)
+		if err != nil {
+			return err
+		}
+		if err := e.client.AssignRole(e.ctx, args[0], args[1]); err != nil {
+			return err
+		}
+		return e.done("assigned role %s to account %s", args[0], args[1])
+	}},
+}
+
+var spaceCommands = map[string]command{
+	"list": {"ORGANIZATION_ID", func(e *env, args []string) error {
+		args, err := e.parse(args, 1, nil)
+		if err != nil {
+			return err
+		}
+		spaces, err := e.client.ListSpaces(e.ctx, args[0])
+		if err != nil {
+			return err
+		}
+		return e.print(spaces, spaceHeader, spaceRows(spaces...))
+	}},
+	"create": {"[-parent SPACE_ID] ORGANIZATION_ID NAME", func(e *env, args []string) error {
+		var parent string
+		args, err := e.parse(args, 2, func(fs *flag.FlagSet) {
+			fs.StringVar(&parent, "parent", "", "parent space")
+		})
+		if err != nil {
+			return err
+		}
+		request := types.CreateSpaceRequest{Name: args[1]}
+		if parent != "" {
+			request.ParentId = &parent
+		}
+		space, err := e.client.CreateSpace(e.ctx, args[0], request)
+		if err != nil {
+			return err
+		}
+		return e.print(space, spaceHeader, spaceRows(*space))
+	}},
+	"tree": {"ORGANIZATION_ID", func(e *env, args []string) error {
+		args, err := e.parse(args, 1, nil)
+		if err != nil {
+			return err
+		}
+		spaces, err := e.client.ListSpaces(e.ctx, args[0])
+		if err != nil {
+			return err
+		}
+		tree := spaceTree(spaces)
+		var rows [][]string
+		var walk func(nodes []*spaceNode, depth int)
+		walk = func(nodes []*spaceNode, depth int) {
+			for _, node := range nodes {
+				rows = append(rows, []string{strings.Repeat("  ", depth) + node.Name, node.ID})
+				walk(node.Children, depth+1)
+			}
+		}
+		walk(tree, 0)
+		return e.print(tree, []string{"NAME", "ID"}, rows)
+	}},
+}
+
+type spaceNode struct {
+	types.Space
+	Children []*spaceNode `json:"children"`
+}
+
+// spaceTree nests spaces under their parents. Spaces whose parent is not in
+// the list become roots.
+func spaceTree(spaces []types.Space) []*spaceNode {
+	nodes := map[string]*spaceNode{}
+	for _, space := range spaces {
+		nodes[space.ID] = &spaceNode{Space: space, Children: make([]*spaceNode, 0)}
+	}
+	roots := make([]*spaceNode, 0)
+	for _, space := range spaces {
+		node := nodes[space.ID]
+		if space.ParentId != nil {
+			if parent, ok := nodes[*space.ParentId]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+	return roots
+}
@@ -0,0 +1,242 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/alterminal/member/types"
+)
+
+func (c *Client) CreateTenant(ctx context.Context, email, password string) (*types.Account, error) {
+	return call[types.Account](ctx, c, "POST", "/tenants", types.CreateTenantRequest{Email: email, Password: password})
+}
+
+func (c *Client) ListTenants(ctx context.Context) ([]types.Account, error) {
+	return list[types.Account](ctx, c, "GET", "/tenants")
+}
+
+func (c *Client) GetTenant(ctx context.Context, id string) (*types.Account, error) {
+	return call[types.Account](ctx, c, "GET", path("/tenants/%s", id), nil)
+}
+
+func (c *Client) DeleteTenant(ctx context.Context, id string) error {
+	return c.do(ctx, "DELETE", path("/tenants/%s", id), nil, nil)
+}
+
+func (c *Client) SetTenantPassword(ctx context.Context, id, password string) error {
+	return c.do(ctx, "PUT", path("/tenants/%s/password", id), types.SetPasswordRequest{Password: password}, nil)
+}
+
+func (c *Client) CreateOrganization(ctx context.Context, name string) (*types.Organization, error) {
+	return call[types.Organization](ctx, c, "POST", "/organizations", types.CreateOrganizationRequest{Name: name})
+}
+
+func (c *Client) SetAllowedOrigins(ctx context.Context, organizationId string, origins []string) (*types.Organization, error) {
+	return call[types.Organization](ctx, c, "PUT", path("/organizations/%s/cors", organizationId), types.SetAllowedOriginsRequest{Origins: origins})
+}
+
+func (c *Client) ListAllOrganizations(ctx context.Context, limit, page int) (types.Pagination[*types.Organization], error) {
+	var pagination types.Pagination[*types.Organization]
+	err := c.do(ctx, "GET", fmt.Sprintf("/organizations/all?limit=%d&page=%d", limit, page), nil, &pagination)
+	return pagination, err
+}
+
+// AllOrganizations iterates over every organization, limit per request.
+func (c *Client) AllOrganizations(ctx context.Context, limit int) *Iterator[types.Organization] {
+	return newIterator(limit, func(limit, page int) (types.Pagination[*types.Organization], error) {
+		return c.ListAllOrganizations(ctx, limit, page)
+	})
+}
+
+func (c *Client) ListMyOrganizations(ctx context.Context) ([]types.Organization, error) {
+	return list[types.Organization](ctx, c, "GET", "/organizations")
+}
+
+func (c *Client) CreateRole(ctx context.Context, organizationId, name string) (*types.Role, error) {
+	return call[types.Role](ctx, c, "POST", path("/organizations/%s/roles", organizationId), types.CreateRoleRequest{Name: name})
+}
+
+func (c *Client) ListRoles(ctx context.Context, organizationId string) ([]types.Role, error) {
+	return list[types.Role](ctx, c, "GET", path("/organizations/%s/roles", organizationId))
+}
+
+func (c *Client) DeleteRole(ctx context.Context, id string) error {
+	return c.do(ctx, "DELETE", path("/organizations/roles/%s", id), nil, nil)
+}
+
+func (c *Client) AssignRole(ctx context.Context, roleId, accountId string) error {
+	return c.do(ctx, "POST", path("/organizations/roles/%s/account", roleId), types.SetAccountRoleRequest{AccountId: accountId}, nil)
+}
+
+func (c *Client) ListMyRoles(ctx context.Context) ([]types.Role, error) {
+	return list[types.Role](ctx, c, "GET", "/roles")
+}
+
+func (c *Client) CreateSpace(ctx context.Context, organizationId string, request types.CreateSpaceRequest) (*types.Space, error) {
+	return call[types.Space](ctx, c, "POST", path("/organizations/%s/spaces", organizationId), request)
+}
+
+func (c *Client) ListSpaces(ctx context.Context, organizationId string) ([]types.Space, error) {
+	return list[types.Space](ctx, c, "GET", path("/organizations/%s/spaces", organizationId))
+}
+
+func (c *Client) SpaceChildren(ctx context.Context, id string) ([]types.Space, error) {
+	return list[types.Space](ctx, c, "GET", path("/spaces/%s/children", id))
+}
+
+func (c *Client) CreateConsumer(ctx context.Context, organizationId string, request types.CreateConsumerRequest) (*types.Account, error) {
+	return call[types.Account](ctx, c, "POST", path("/organizations/%s/consumers", organizationId), request)
+}
+
+func (c *Client) ListConsumers(ctx context.Context, organizationId string) ([]types.Account, error) {
+	return list[types.Account](ctx, c, "GET", path("/organizations/%s/consumers", organizationId))
+}
+
+func (c *Client) CreateSubscriptionPlan(ctx context.Context, spaceId string, request types.CreateSubscriptionPlanRequest) (*types.SubscriptionPlan, error) {
+	return call[types.SubscriptionPlan](ctx, c, "POST", path("/spaces/%s/subscriptionPlan", spaceId), request)
+}
+
+func (c *Client) ListSubscriptionPlans(ctx context.Context, spaceId string) ([]types.SubscriptionPlan, error) {
+	return list[types.SubscriptionPlan](ctx, c, "GET", path("/spaces/%s/subscriptionPlan", spaceId))
+}
+
+func (c *Client) ListEntitlements(ctx context.Context, spaceId string) ([]types.Entitlement, error) {
+	return list[types.Entitlement](ctx, c, "GET", path("/spaces/%s/entitlements", spaceId))
+}
+
+// Entitled reports whether the space has a live subscription of the plan.
+func (c *Client) Entitled(ctx context.Context, spaceId, planId string) (bool, error) {
+	entitlements, err := c.ListEntitlements(ctx, spaceId)
+	if err != nil {
+		return false, err
+	}
+	for _, entitlement := range entitlements {
+		if entitlement.SubscriptionPlanID == planId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (c *Client) CreateSubscription(ctx context.Context, planId string) (*types.Checkout, error) {
+	return call[types.Checkout](ctx, c, "POST", path("/subscriptionPlan/%s/subscription", planId), nil)
+}
+
+func (c *Client) CancelSubscription(ctx context.Context, id, secret string) error {
+	return c.do(ctx, "DELETE", path("/subscriptions/%s", id), types.CancelSubscriptionRequest{Secret: secret}, nil)
+}
+
+// AuditFilter narrows an audit search. Zero fields match everything.
+type AuditFilter struct {
+	OrganizationId string
+	ActorId        string
+	Action         string
+	TargetType     string
+	TargetId       string
+	Since          time.Time
+	Until          time.Time
+}
+
+func auditPath(base string, filter AuditFilter, limit, page int) string {
+	query := url.Values{}
+	for key, value := range map[string]string{
+		"organizationId": filter.OrganizationId,
+		"actorId":        filter.ActorId,
+		"action":         filter.Action,
+		"targetType":     filter.TargetType,
+		"targetId":       filter.TargetId,
+	} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	if !filter.Since.IsZero() {
+		query.Set("since", filter.Since.Format(time.RFC3339))
+	}
+	if !filter.Until.IsZero() {
+		query.Set("until", filter.Until.Format(time.RFC3339))
+	}
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("page", strconv.Itoa(page))
+	return base + "?" + query.Encode()
+}
+
+func (c *Client) ListOrganizationAudit(ctx context.Context, organizationId string, filter AuditFilter, limit, page int) (types.Pagination[*types.AuditEntry], error) {
+	var pagination types.Pagination[*types.AuditEntry]
+	err := c.do(ctx, "GET", auditPath(path("/organizations/%s/audit", organizationId), filter, limit, page), nil, &pagination)
+	return pagination, err
+}
+
+func (c *Client) SearchAudit(ctx context.Context, filter AuditFilter, limit, page int) (types.Pagination[*types.AuditEntry], error) {
+	var pagination types.Pagination[*types.AuditEntry]
+	err := c.do(ctx, "GET", auditPath("/audit", filter, limit, page), nil, &pagination)
+	return pagination, err
+}
+
+// Audit iterates over every matching audit entry, limit per request.
+func (c *Client) Audit(ctx context.Context, filter AuditFilter, limit int) *Iterator[types.AuditEntry] {
+	return newIterator(limit, func(limit, page int) (types.Pagination[*types.AuditEntry], error) {
+		return c.SearchAudit(ctx, filter, limit, page)
+	})
+}
+
+func (c *Client) UpdateSpace(ctx context.Context, id, name string) (*types.Space, error) {
+	return call[types.Space](ctx, c, "PUT", path("/spaces/%s", id), types.UpdateSpaceRequest{Name: name})
+}
+
+func (c *Client) CreateWebhook(ctx context.Context, organizationId, url string, events []string) (*types.CreatedWebhook, error) {
+	return call[types.CreatedWebhook](ctx, c, "POST", path("/organizations/%s/webhooks", organizationId), types.CreateWebhookRequest{URL: url, Events: events})
+}
+
+func (c *Client) ListWebhooks(ctx context.Context, organizationId string) ([]types.Webhook, error) {
+	return list[types.Webhook](ctx, c, "GET", path("/organizations/%s/webhooks", organizationId))
+}
+
+func (c *Client) DeleteWebhook(ctx context.Context, organizationId, webhookId string) error {
+	return c.do(ctx, "DELETE", path("/organizations/%s/webhooks/%s", organizationId, webhookId), nil, nil)
+}
+
+func (c *Client) ListWebhookDeliveries(ctx context.Context, organizationId, webhookId string, limit, page int) (types.Pagination[*types.WebhookDelivery], error) {
+	var pagination types.Pagination[*types.WebhookDelivery]
+	err := c.do(ctx, "GET", path("/organizations/%s/webhooks/%s/deliveries", organizationId, webhookId)+fmt.Sprintf("?limit=%d&page=%d", limit, page), nil, &pagination)
+	return pagination, err
+}
+
+func (c *Client) Redeliver(ctx context.Context, organizationId, webhookId, deliveryId string) (*types.WebhookDelivery, error) {
+	return call[types.WebhookDelivery](ctx, c, "POST", path("/organizations/%s/webhooks/%s/deliveries/%s/redeliver", organizationId, webhookId, deliveryId), nil)
+}
+
+type JobFilter struct {
+	Type    string
+	Subject string
+	Status  string
+}
+
+func (c *Client) ListJobs(ctx context.Context, filter JobFilter, limit, page int) (types.Pagination[*types.Job], error) {
+	query := url.Values{}
+	for key, value := range map[string]string{
+		"type":    filter.Type,
+		"subject": filter.Subject,
+		"status":  filter.Status,
+	} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("page", strconv.Itoa(page))
+	var pagination types.Pagination[*types.Job]
+	err := c.do(ctx, "GET", "/jobs?"+query.Encode(), nil, &pagination)
+	return pagination, err
+}
+
+func (c *Client) GetJob(ctx context.Context, id string) (*types.Job, error) {
+	return call[types.Job](ctx, c, "GET", path("/jobs/%s", id), nil)
+}
+
+func (c *Client) RetryJob(ctx context.Context, id string) (*types.Job, error) {
+	return call[types.Job](ctx, c, "POST", path("/jobs/%s/retry", id), nil)
+}
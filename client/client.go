@@ -0,0 +1,131 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client calls the member service over HTTP. AccessToken is sent as a bearer
+// token when set.
+type Client struct {
+	BaseUrl     string
+	AccessToken string
+	HttpClient  *http.Client
+}
+
+// Error is a failed response of the member service.
+type Error struct {
+	StatusCode int          `json:"-"`
+	Code       string       `json:"code"`
+	Message    string       `json:"message"`
+	Details    []FieldError `json:"details,omitempty"`
+	RequestID  string       `json:"requestId,omitempty"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("member: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+func statusOf(err error) int {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.StatusCode
+	}
+	return 0
+}
+
+func IsNotFound(err error) bool {
+	return statusOf(err) == http.StatusNotFound
+}
+
+func IsUnauthorized(err error) bool {
+	return statusOf(err) == http.StatusUnauthorized
+}
+
+func IsForbidden(err error) bool {
+	return statusOf(err) == http.StatusForbidden
+}
+
+func IsConflict(err error) bool {
+	return statusOf(err) == http.StatusConflict
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HttpClient == nil {
+		return http.DefaultClient
+	}
+	return c.HttpClient
+}
+
+func path(format string, ids ...string) string {
+	escaped := make([]any, len(ids))
+	for i, id := range ids {
+		escaped[i] = url.PathEscape(id)
+	}
+	return fmt.Sprintf(format, escaped...)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, result any) error {
+	var reader io.Reader
+	if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(buf)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(c.BaseUrl, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.AccessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.AccessToken)
+	}
+	res, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 400 {
+		e := &Error{StatusCode: res.StatusCode}
+		if err := json.NewDecoder(res.Body).Decode(e); err != nil || e.Code == "" {
+			e.Message = http.StatusText(res.StatusCode)
+		}
+		return e
+	}
+	if result == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(result)
+}
+
+func call[T any](ctx context.Context, c *Client, method, path string, body any) (*T, error) {
+	var result T
+	if err := c.do(ctx, method, path, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func list[T any](ctx context.Context, c *Client, method, path string) ([]T, error) {
+	var result []T
+	if err := c.do(ctx, method, path, nil, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,309 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	authApi "github.com/alterminal/auth/api"
+	"github.com/alterminal/member/accounts"
+	"github.com/alterminal/member/api"
+	"github.com/alterminal/member/billing"
+	"github.com/alterminal/member/health"
+	"github.com/alterminal/member/jobs"
+	"github.com/alterminal/member/lease"
+	"github.com/alterminal/member/model"
+	"github.com/alterminal/member/payment"
+	"github.com/alterminal/member/ratelimit"
+	"github.com/alterminal/member/repo"
+	"github.com/alterminal/member/types"
+	"github.com/gin-gonic/gin"
+)
+
+// fakeGateway opens checkouts that stay pending and records cancellations.
+type fakeGateway struct {
+	mu       sync.Mutex
+	canceled []string
+}
+
+func (g *fakeGateway) CreateSubscription(ctx context.Context, itemName string, price int, currency string) (*payment.Subscription, error) {
+	id := model.NewID()
+	return &payment.Subscription{ID: id, Link: "https://checkout.example.com/" + id, Status: model.SubscriptionPending}, nil
+}
+
+func (g *fakeGateway) CancelSubscription(ctx context.Context, subscriptionId string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.canceled = append(g.canceled, subscriptionId)
+	return nil
+}
+
+func (g *fakeGateway) RetrieveSubscription(ctx context.Context, subscriptionId string) (*payment.Subscription, error) {
+	return &payment.Subscription{ID: subscriptionId, Status: model.SubscriptionPending}, nil
+}
+
+func (g *fakeGateway) CancelPayment(ctx context.Context, subscriptionId string) error {
+	return nil
+}
+
+type testServer struct {
+	repos    repo.Repositories
+	provider *accounts.Memory
+	gateway  *fakeGateway
+	url      string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	repos := repo.NewMemory()
+	provider := accounts.NewMemory()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	gateway := &fakeGateway{}
+	scheduler := jobs.New(ctx, repos.Jobs, jobs.Config{Workers: 1}, lease.New(ctx, repos.Leases, time.Minute, logger), logger)
+	billing := billing.New(repos, payment.Gateways{"stripe": gateway}, scheduler, logger)
+	router := api.NewRouter(repos, billing, nil, nil, provider, api.Options{
+		Health:     health.New(time.Second),
+		CORS:       api.NewCORS(api.CORSConfig{}, api.CORSConfig{}, api.CORSConfig{}),
+		RateLimits: api.NewRateLimits(ratelimit.NewMemory(), api.RateLimit{}, api.RateLimit{}, api.RateLimit{}),
+		Logger:     logger,
+	})
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return &testServer{repos: repos, provider: provider, gateway: gateway, url: server.URL}
+}
+
+// client returns a client with a token of a new account in namespace.
+func (s *testServer) client(t *testing.T, namespace, email string) (*Client, string) {
+	t.Helper()
+	account, err := s.provider.CreateAccount(context.Background(), authApi.CreateAccountRequest{Namespace: namespace, Email: email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Client{BaseUrl: s.url, AccessToken: s.provider.IssueToken(account.ID)}, account.ID
+}
+
+func TestErrors(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer(t)
+	admin, _ := server.client(t, "admin", "admin@example.com")
+	tenant, _ := server.client(t, "tenant", "tenant@example.com")
+	anonymous := &Client{BaseUrl: server.url}
+	if _, err := admin.CreateTenant(ctx, "other@example.com", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name  string
+		err   error
+		is    func(error) bool
+		field string
+	}{
+		{"not found", func() error { _, err := admin.GetTenant(ctx, "0"); return err }(), IsNotFound, ""},
+		{"conflict", func() error { _, err := admin.CreateTenant(ctx, "other@example.com", "secret"); return err }(), IsConflict, ""},
+		{"unauthorized", func() error { _, err := anonymous.ListTenants(ctx); return err }(), IsUnauthorized, ""},
+		{"forbidden", func() error { _, err := tenant.ListTenants(ctx); return err }(), IsForbidden, ""},
+		{"invalid", func() error { _, err := admin.CreateTenant(ctx, "invalid", "secret"); return err }(), func(err error) bool { return statusOf(err) == 400 }, "email"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if !test.is(test.err) {
+				t.Fatalf("err = %v", test.err)
+			}
+			var e *Error
+			if !errors.As(test.err, &e) || e.Code == "" || e.RequestID == "" {
+				t.Errorf("error = %+v, want code and request id", e)
+			}
+			if test.field != "" && (len(e.Details) != 1 || e.Details[0].Field != test.field) {
+				t.Errorf("details = %+v, want field %s", e.Details, test.field)
+			}
+		})
+	}
+}
+
+func TestCanceledContext(t *testing.T) {
+	server := newTestServer(t)
+	admin, _ := server.client(t, "admin", "admin@example.com")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := admin.ListTenants(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestOrganizations(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer(t)
+	admin, _ := server.client(t, "admin", "admin@example.com")
+	tenant, tenantId := server.client(t, "tenant", "tenant@example.com")
+	var created []string
+	for range 5 {
+		organization, err := admin.CreateOrganization(ctx, "organization")
+		if err != nil {
+			t.Fatal(err)
+		}
+		created = append(created, organization.ID)
+	}
+	var listed []string
+	it := admin.AllOrganizations(ctx, 2)
+	for it.Next() {
+		listed = append(listed, it.Item().ID)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != len(created) {
+		t.Errorf("iterated %v, want %v", listed, created)
+	}
+
+	role, err := admin.CreateRole(ctx, created[0], "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := admin.AssignRole(ctx, role.ID, tenantId); err != nil {
+		t.Fatal(err)
+	}
+	organizations, err := tenant.ListMyOrganizations(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(organizations) != 1 || organizations[0].ID != created[0] {
+		t.Errorf("organizations = %+v, want %s", organizations, created[0])
+	}
+	roles, err := tenant.ListMyRoles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 1 || roles[0].ID != role.ID {
+		t.Errorf("roles = %+v, want %s", roles, role.ID)
+	}
+}
+
+func TestSpacesAndEntitlements(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer(t)
+	tenant, tenantId := server.client(t, "tenant", "tenant@example.com")
+	organization := model.Organization{Name: "organization"}
+	if err := server.repos.Organizations.Create(ctx, &organization); err != nil {
+		t.Fatal(err)
+	}
+	role := model.Role{OrganizationID: organization.ID, Name: "admin"}
+	if err := server.repos.Roles.Create(ctx, &role); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.repos.Roles.AddAccount(ctx, role.ID, tenantId); err != nil {
+		t.Fatal(err)
+	}
+
+	space, err := tenant.CreateSpace(ctx, organization.ID, types.CreateSpaceRequest{Name: "space"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, err := tenant.CreateSpace(ctx, organization.ID, types.CreateSpaceRequest{Name: "child", ParentId: &space.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	children, err := tenant.SpaceChildren(ctx, space.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != 1 || children[0].ID != child.ID {
+		t.Errorf("children = %+v, want %s", children, child.ID)
+	}
+	if _, err := tenant.UpdateSpace(ctx, space.ID, "renamed"); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := tenant.CreateSubscriptionPlan(ctx, space.ID, types.CreateSubscriptionPlanRequest{PaymentGateway: "stripe", PlanName: "plan", Currency: "usd", Price: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := tenant.CreateSubscriptionPlan(ctx, space.ID, types.CreateSubscriptionPlanRequest{PaymentGateway: "stripe", PlanName: "other", Currency: "usd", Price: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, subscription := range []model.Subscription{
+		{SubscriptionPlanId: plan.ID, Status: model.SubscriptionActive},
+		{SubscriptionPlanId: other.ID, Status: model.SubscriptionCanceled},
+	} {
+		if err := server.repos.Subscriptions.Create(ctx, &subscription); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, test := range []struct {
+		plan     string
+		entitled bool
+	}{
+		{plan.ID, true},
+		{other.ID, false},
+	} {
+		entitled, err := tenant.Entitled(ctx, space.ID, test.plan)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entitled != test.entitled {
+			t.Errorf("plan %s: entitled = %t, want %t", test.plan, entitled, test.entitled)
+		}
+	}
+
+	consumer, err := tenant.CreateConsumer(ctx, organization.ID, types.CreateConsumerRequest{PhoneRegion: "852", PhoneNumber: "91234567", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	consumers, err := tenant.ListConsumers(ctx, organization.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(consumers) != 1 || consumers[0].ID != consumer.ID {
+		t.Errorf("consumers = %+v, want %s", consumers, consumer.ID)
+	}
+}
+
+func TestCreateAndCancelSubscription(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer(t)
+	anonymous := &Client{BaseUrl: server.url}
+	space := model.Space{OrganizationID: model.NewID(), Name: "space"}
+	if err := server.repos.Spaces.Create(ctx, &space); err != nil {
+		t.Fatal(err)
+	}
+	plan := model.SubscriptionPlan{SpaceID: space.ID, PaymentGateway: "stripe", PlanName: "plan", Currency: "usd", Price: 100}
+	if err := server.repos.SubscriptionPlans.Create(ctx, &plan); err != nil {
+		t.Fatal(err)
+	}
+
+	checkout, err := anonymous.CreateSubscription(ctx, plan.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscription, err := server.repos.Subscriptions.Get(ctx, checkout.ID)
+	if err != nil {
+		t.Fatalf("subscription %s: %v", checkout.ID, err)
+	}
+	if err := anonymous.CancelSubscription(ctx, checkout.ID, checkout.Secret); !IsConflict(err) {
+		t.Fatalf("cancel pending subscription: err = %v, want conflict", err)
+	}
+
+	// The checkout completes.
+	subscription.Status = model.SubscriptionActive
+	if err := server.repos.Subscriptions.Save(ctx, subscription); err != nil {
+		t.Fatal(err)
+	}
+	if err := anonymous.CancelSubscription(ctx, checkout.ID, checkout.Secret); err != nil {
+		t.Fatal(err)
+	}
+	canceled, err := server.repos.Subscriptions.Get(ctx, checkout.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if canceled.Status != model.SubscriptionCanceled {
+		t.Errorf("status = %s, want %s", canceled.Status, model.SubscriptionCanceled)
+	}
+	if len(server.gateway.canceled) != 1 || server.gateway.canceled[0] != subscription.PaymentId {
+		t.Errorf("canceled at gateway = %v, want %s", server.gateway.canceled, subscription.PaymentId)
+	}
+}
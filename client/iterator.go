@@ -0,0 +1,60 @@
+package client
+
+import "github.com/alterminal/member/types"
+
+// Iterator walks every item of a paginated listing, fetching pages lazily.
+//
+//	it := c.AllOrganizations(ctx, 50)
+//	for it.Next() {
+//		organization := it.Item()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+type Iterator[T any] struct {
+	fetch func(limit, page int) (types.Pagination[*T], error)
+	limit int
+	page  int
+	items []*T
+	index int
+	item  *T
+	done  bool
+	err   error
+}
+
+func newIterator[T any](limit int, fetch func(limit, page int) (types.Pagination[*T], error)) *Iterator[T] {
+	return &Iterator[T]{fetch: fetch, limit: limit, index: -1}
+}
+
+func (it *Iterator[T]) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if it.index+1 >= len(it.items) {
+		if it.done {
+			return false
+		}
+		pagination, err := it.fetch(it.limit, it.page)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.items = pagination.Items
+		it.index = -1
+		it.page++
+		it.done = len(pagination.Items) == 0 || it.page*it.limit >= pagination.Total
+		if len(it.items) == 0 {
+			return false
+		}
+	}
+	it.index++
+	it.item = it.items[it.index]
+	return true
+}
+
+func (it *Iterator[T]) Item() *T {
+	return it.item
+}
+
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
@@ -0,0 +1,383 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix prefixes the environment variables that override config keys,
+// e.g. MEMBER_DATABASE_HOST for database.host.
+const EnvPrefix = "MEMBER"
+
+type Config struct {
+	Database  DatabaseConfig  `mapstructure:"database"`
+	Server    ServerConfig    `mapstructure:"server"`
+	Log       LogConfig       `mapstructure:"log"`
+	Tracing   TracingConfig   `mapstructure:"tracing"`
+	Health    HealthConfig    `mapstructure:"health"`
+	Auth      AuthConfig      `mapstructure:"auth"`
+	Stripe    StripeConfig    `mapstructure:"stripe"`
+	Billing   BillingConfig   `mapstructure:"billing"`
+	Cors      CorsConfig      `mapstructure:"cors"`
+	RateLimit RateLimitConfig `mapstructure:"rateLimit"`
+	Webhooks  WebhooksConfig  `mapstructure:"webhooks"`
+	Outbox    OutboxConfig    `mapstructure:"outbox"`
+	Lease     LeaseConfig     `mapstructure:"lease"`
+	Jobs      JobsConfig      `mapstructure:"jobs"`
+}
+
+type DatabaseConfig struct {
+	Driver   string `mapstructure:"driver"`
+	Host     string `mapstructure:"host"`
+	Port     string `mapstructure:"port"`
+	User     string `mapstructure:"user"`
+	Password string `mapstructure:"password"`
+	Database string `mapstructure:"database"`
+	SslMode  string `mapstructure:"sslmode"`
+}
+
+type ServerConfig struct {
+	Addr string `mapstructure:"addr"`
+	// TrustedProxies may set X-Forwarded-For for the client IP.
+	TrustedProxies  []string      `mapstructure:"trustedProxies"`
+	ShutdownTimeout time.Duration `mapstructure:"shutdownTimeout"`
+	DrainDelay      time.Duration `mapstructure:"drainDelay"`
+}
+
+type LogConfig struct {
+	Level  string `mapstructure:"level" reload:"true"`
+	Format string `mapstructure:"format"`
+}
+
+type TracingConfig struct {
+	Exporter    string  `mapstructure:"exporter"`
+	Endpoint    string  `mapstructure:"endpoint"`
+	Insecure    bool    `mapstructure:"insecure"`
+	SampleRatio float64 `mapstructure:"sampleRatio"`
+}
+
+type HealthConfig struct {
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+type AuthConfig struct {
+	Provider    string          `mapstructure:"provider"`
+	BaseUrl     string          `mapstructure:"baseUrl"`
+	AccessToken string          `mapstructure:"accessToken"`
+	JwtSecret   string          `mapstructure:"jwtSecret"`
+	AdminEmail  string          `mapstructure:"adminEmail"`
+	AdminToken  string          `mapstructure:"adminToken"`
+	Cache       AuthCacheConfig `mapstructure:"cache"`
+}
+
+type AuthCacheConfig struct {
+	Size        int           `mapstructure:"size"`
+	TTL         time.Duration `mapstructure:"ttl"`
+	NegativeTTL time.Duration `mapstructure:"negativeTtl"`
+}
+
+type StripeConfig struct {
+	Key string `mapstructure:"key" reload:"true"`
+}
+
+type BillingConfig struct {
+	WatchInterval time.Duration `mapstructure:"watchInterval" reload:"true"`
+	// CheckoutTTL is how long a checkout stays open before it is expired.
+	CheckoutTTL time.Duration `mapstructure:"checkoutTtl" reload:"true"`
+}
+
+type WebhooksConfig struct {
+	Timeout     time.Duration `mapstructure:"timeout"`
+	MaxAttempts int           `mapstructure:"maxAttempts"`
+	// Backoff is the delay before the first retry, doubled for every later
+	// one.
+	Backoff      time.Duration `mapstructure:"backoff"`
+	PollInterval time.Duration `mapstructure:"pollInterval"`
+}
+
+type OutboxConfig struct {
+	// PollInterval is how often the relay publishes new events.
+	PollInterval time.Duration `mapstructure:"pollInterval"`
+}
+
+type JobsConfig struct {
+	// Workers bounds how many jobs run at once.
+	Workers     int `mapstructure:"workers"`
+	MaxAttempts int `mapstructure:"maxAttempts"`
+	// Backoff is the delay before the first retry, doubled for every later
+	// one.
+	Backoff      time.Duration `mapstructure:"backoff"`
+	PollInterval time.Duration `mapstructure:"pollInterval"`
+}
+
+type LeaseConfig struct {
+	// TTL is how long a lease outlives a replica that stopped renewing it.
+	TTL time.Duration `mapstructure:"ttl"`
+}
+
+// CorsConfig holds one policy per route group: checkout and the API
+// document are public, organization management is for tenants and the rest
+// is for admins.
+type CorsConfig struct {
+	Public CorsPolicyConfig `mapstructure:"public"`
+	Tenant CorsPolicyConfig `mapstructure:"tenant"`
+	Admin  CorsPolicyConfig `mapstructure:"admin"`
+}
+
+type CorsPolicyConfig struct {
+	// Origins lists the origins allowed to call the API from a browser. "*"
+	// allows every origin.
+	Origins     []string      `mapstructure:"origins" reload:"true"`
+	Headers     []string      `mapstructure:"headers" reload:"true"`
+	Methods     []string      `mapstructure:"methods" reload:"true"`
+	Credentials bool          `mapstructure:"credentials" reload:"true"`
+	MaxAge      time.Duration `mapstructure:"maxAge" reload:"true"`
+}
+
+// RateLimitConfig holds the token buckets of each route group, see
+// CorsConfig for the groups.
+type RateLimitConfig struct {
+	Public RateLimitGroupConfig `mapstructure:"public"`
+	Tenant RateLimitGroupConfig `mapstructure:"tenant"`
+	Admin  RateLimitGroupConfig `mapstructure:"admin"`
+}
+
+// RateLimitGroupConfig limits requests per client IP, per authenticated
+// account and per organization owning the resource.
+type RateLimitGroupConfig struct {
+	IP           LimitConfig `mapstructure:"ip"`
+	Account      LimitConfig `mapstructure:"account"`
+	Organization LimitConfig `mapstructure:"organization"`
+}
+
+// LimitConfig refills a bucket with Rate tokens per second up to Burst. A
+// zero Rate disables the limit.
+type LimitConfig struct {
+	Rate  float64 `mapstructure:"rate" reload:"true"`
+	Burst int     `mapstructure:"burst" reload:"true"`
+}
+
+func Default() Config {
+	return Config{
+		Database: DatabaseConfig{Driver: "mysql", SslMode: "disable"},
+		Server:   ServerConfig{Addr: ":8080", ShutdownTimeout: 15 * time.Second, DrainDelay: 5 * time.Second},
+		Log:      LogConfig{Level: "info", Format: "json"},
+		Tracing:  TracingConfig{SampleRatio: 1},
+		Health:   HealthConfig{Timeout: 2 * time.Second},
+		Auth: AuthConfig{
+			Provider: "sdk",
+			Cache:    AuthCacheConfig{Size: 10000, TTL: time.Minute, NegativeTTL: 10 * time.Second},
+		},
+		Billing: BillingConfig{WatchInterval: 5 * time.Second, CheckoutTTL: 24 * time.Hour},
+		Webhooks: WebhooksConfig{
+			Timeout:      10 * time.Second,
+			MaxAttempts:  8,
+			Backoff:      30 * time.Second,
+			PollInterval: 5 * time.Second,
+		},
+		Outbox: OutboxConfig{PollInterval: time.Second},
+		Lease:  LeaseConfig{TTL: 30 * time.Second},
+		Jobs: JobsConfig{
+			Workers:      8,
+			MaxAttempts:  10,
+			Backoff:      10 * time.Second,
+			PollInterval: time.Second,
+		},
+		Cors: CorsConfig{
+			Public: corsPolicy("*"),
+			Tenant: corsPolicy(),
+			Admin:  corsPolicy(),
+		},
+		RateLimit: RateLimitConfig{
+			Public: RateLimitGroupConfig{
+				IP:           LimitConfig{Rate: 0.5, Burst: 10},
+				Organization: LimitConfig{Rate: 5, Burst: 50},
+			},
+			Tenant: RateLimitGroupConfig{
+				Account: LimitConfig{Rate: 10, Burst: 100},
+			},
+		},
+	}
+}
+
+func corsPolicy(origins ...string) CorsPolicyConfig {
+	return CorsPolicyConfig{
+		Origins: origins,
+		Headers: []string{"Authorization", "Content-Type", "X-Request-Id"},
+		Methods: []string{"GET", "POST", "PUT", "DELETE"},
+		MaxAge:  10 * time.Minute,
+	}
+}
+
+// Load reads the .env yaml file found in path, which may also name the file
+// itself, and applies the MEMBER_* environment variables on top. The file is
+// optional when path is empty.
+func Load(path string) (*Config, error) {
+	v := newViper(path)
+	if err := v.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if !errors.As(err, &notFound) || path != "" {
+			return nil, fmt.Errorf("reading config: %w", err)
+		}
+	}
+	return decode(v)
+}
+
+func newViper(path string) *viper.Viper {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		v.SetConfigFile(path)
+	} else {
+		v.SetConfigName(".env")
+		if path == "" {
+			v.AddConfigPath(".")
+		} else {
+			v.AddConfigPath(path)
+		}
+	}
+	setDefaults(v, "", reflect.ValueOf(Default()))
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	return v
+}
+
+func decode(v *viper.Viper) (*Config, error) {
+	config := &Config{}
+	if err := v.Unmarshal(config); err != nil {
+		return nil, fmt.Errorf("decoding config: %w", err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// setDefaults registers every key of the config, which is what makes
+// AutomaticEnv consider the environment for keys absent from the file.
+func setDefaults(v *viper.Viper, prefix string, value reflect.Value) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		key := prefix + field.Tag.Get("mapstructure")
+		if field.Type.Kind() == reflect.Struct {
+			setDefaults(v, key+".", value.Field(i))
+			continue
+		}
+		v.SetDefault(key, value.Field(i).Interface())
+	}
+}
+
+// Validate reports every invalid or missing key at once.
+func (c *Config) Validate() error {
+	var errs []error
+	required := func(key, value string) {
+		if value == "" {
+			errs = append(errs, fmt.Errorf("%s is required", key))
+		}
+	}
+	positive := func(key string, value time.Duration) {
+		if value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", key))
+		}
+	}
+	switch c.Database.Driver {
+	case "mysql", "postgres":
+		required("database.host", c.Database.Host)
+		required("database.user", c.Database.User)
+		required("database.database", c.Database.Database)
+	case "sqlite":
+		required("database.database", c.Database.Database)
+	default:
+		errs = append(errs, fmt.Errorf("database.driver must be mysql, postgres or sqlite, got %q", c.Database.Driver))
+	}
+	required("server.addr", c.Server.Addr)
+	positive("server.shutdownTimeout", c.Server.ShutdownTimeout)
+	if c.Server.DrainDelay < 0 {
+		errs = append(errs, errors.New("server.drainDelay must not be negative"))
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("log.level must be debug, info, warn or error, got %q", c.Log.Level))
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		errs = append(errs, fmt.Errorf("log.format must be json or text, got %q", c.Log.Format))
+	}
+	switch c.Tracing.Exporter {
+	case "", "otlp", "stdout":
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter must be otlp or stdout, got %q", c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, errors.New("tracing.sampleRatio must be between 0 and 1"))
+	}
+	positive("health.timeout", c.Health.Timeout)
+	switch c.Auth.Provider {
+	case "sdk":
+		required("auth.baseUrl", c.Auth.BaseUrl)
+		required("auth.accessToken", c.Auth.AccessToken)
+	case "memory":
+	default:
+		errs = append(errs, fmt.Errorf("auth.provider must be sdk or memory, got %q", c.Auth.Provider))
+	}
+	if c.Auth.Cache.Size < 1 {
+		errs = append(errs, errors.New("auth.cache.size must be at least 1"))
+	}
+	positive("auth.cache.ttl", c.Auth.Cache.TTL)
+	positive("auth.cache.negativeTtl", c.Auth.Cache.NegativeTTL)
+	required("stripe.key", c.Stripe.Key)
+	positive("billing.watchInterval", c.Billing.WatchInterval)
+	positive("billing.checkoutTtl", c.Billing.CheckoutTTL)
+	positive("webhooks.timeout", c.Webhooks.Timeout)
+	if c.Webhooks.MaxAttempts < 1 || c.Webhooks.MaxAttempts > 100 {
+		errs = append(errs, errors.New("webhooks.maxAttempts must be between 1 and 100"))
+	}
+	positive("webhooks.backoff", c.Webhooks.Backoff)
+	positive("webhooks.pollInterval", c.Webhooks.PollInterval)
+	positive("outbox.pollInterval", c.Outbox.PollInterval)
+	positive("lease.ttl", c.Lease.TTL)
+	if c.Jobs.Workers < 1 {
+		errs = append(errs, errors.New("jobs.workers must be at least 1"))
+	}
+	if c.Jobs.MaxAttempts < 1 || c.Jobs.MaxAttempts > 100 {
+		errs = append(errs, errors.New("jobs.maxAttempts must be between 1 and 100"))
+	}
+	positive("jobs.backoff", c.Jobs.Backoff)
+	positive("jobs.pollInterval", c.Jobs.PollInterval)
+	cors := func(group string, policy CorsPolicyConfig) {
+		if policy.Credentials && slices.Contains(policy.Origins, "*") {
+			errs = append(errs, fmt.Errorf("cors.%s.credentials cannot be combined with the origin *", group))
+		}
+		if policy.MaxAge < 0 {
+			errs = append(errs, fmt.Errorf("cors.%s.maxAge must not be negative", group))
+		}
+	}
+	cors("public", c.Cors.Public)
+	cors("tenant", c.Cors.Tenant)
+	cors("admin", c.Cors.Admin)
+	limit := func(key string, limit LimitConfig) {
+		if limit.Rate < 0 {
+			errs = append(errs, fmt.Errorf("%s.rate must not be negative", key))
+		}
+		if limit.Rate > 0 && limit.Burst < 1 {
+			errs = append(errs, fmt.Errorf("%s.burst must be at least 1", key))
+		}
+	}
+	rateLimit := func(group string, config RateLimitGroupConfig) {
+		limit("rateLimit."+group+".ip", config.IP)
+		limit("rateLimit."+group+".account", config.Account)
+		limit("rateLimit."+group+".organization", config.Organization)
+	}
+	rateLimit("public", c.RateLimit.Public)
+	rateLimit("tenant", c.RateLimit.Tenant)
+	rateLimit("admin", c.RateLimit.Admin)
+	return errors.Join(errs...)
+}
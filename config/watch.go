@@ -0,0 +1,71 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watch reloads the config file whenever it changes. A reload that passes
+// validation and only touches keys tagged reload:"true" is handed to apply;
+// anything else is rejected and the running config is kept. Watch does
+// nothing when no config file was found.
+func Watch(path string, current *Config, logger *slog.Logger, apply func(*Config)) {
+	v := newViper(path)
+	if err := v.ReadInConfig(); err != nil {
+		return
+	}
+	var mu sync.Mutex
+	v.OnConfigChange(func(event fsnotify.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		logger := logger.With("file", event.Name)
+		next, err := decode(v)
+		if err != nil {
+			logger.Error("config reload rejected", "error", err)
+			return
+		}
+		changed, restart := changes(current, next)
+		if len(restart) > 0 {
+			logger.Error("config reload rejected", "error", fmt.Sprintf("changing %s requires a restart", strings.Join(restart, ", ")))
+			return
+		}
+		if len(changed) == 0 {
+			return
+		}
+		apply(next)
+		current = next
+		logger.Info("config reloaded", "changed", changed)
+	})
+	v.WatchConfig()
+}
+
+// changes lists the keys that differ between two configs, split by whether
+// they can be applied while running.
+func changes(current, next *Config) (changed, restart []string) {
+	var walk func(prefix string, a, b reflect.Value)
+	walk = func(prefix string, a, b reflect.Value) {
+		for i := 0; i < a.NumField(); i++ {
+			field := a.Type().Field(i)
+			key := prefix + field.Tag.Get("mapstructure")
+			if field.Type.Kind() == reflect.Struct {
+				walk(key+".", a.Field(i), b.Field(i))
+				continue
+			}
+			if reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+				continue
+			}
+			if field.Tag.Get("reload") == "true" {
+				changed = append(changed, key)
+			} else {
+				restart = append(restart, key)
+			}
+		}
+	}
+	walk("", reflect.ValueOf(*current), reflect.ValueOf(*next))
+	return changed, restart
+}
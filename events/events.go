@@ -0,0 +1,71 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/alterminal/member/model"
+	"github.com/alterminal/member/repo"
+)
+
+// Event is a committed domain event. Its ID is stable across the retries of
+// the relay, so consumers can drop duplicates.
+type Event struct {
+	ID             string          `json:"id"`
+	Type           string          `json:"type"`
+	OrganizationID string          `json:"organizationId"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	Data           json.RawMessage `json:"data"`
+}
+
+type Handler func(ctx context.Context, event Event) error
+
+// Bus carries events from the relay to their consumers. Publish returns an
+// error when the event should be published again.
+type Bus interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// Memory is an in-process Bus calling every handler in the order they
+// subscribed.
+type Memory struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (b *Memory) Subscribe(handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+func (b *Memory) Publish(ctx context.Context, event Event) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	var errs []error
+	for _, handler := range b.handlers {
+		errs = append(errs, handler(ctx, event))
+	}
+	return errors.Join(errs...)
+}
+
+// Record adds an event to outbox. Pass the outbox of the transaction making
+// the change so that both are committed together.
+func Record(ctx context.Context, outbox repo.Outbox, eventType, organizationId string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return outbox.Add(ctx, &model.OutboxEvent{
+		Type:           eventType,
+		OrganizationID: organizationId,
+		Payload:        string(payload),
+	})
+}
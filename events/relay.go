@@ -0,0 +1,95 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/alterminal/member/lease"
+	"github.com/alterminal/member/metrics"
+	"github.com/alterminal/member/model"
+	"github.com/alterminal/member/repo"
+)
+
+// Relay publishes the events of the outbox to a Bus, at least once. An event
+// that fails is retried on the next poll without holding back later ones.
+// Only the replica holding the relay lease publishes.
+type Relay struct {
+	ctx      context.Context
+	outbox   repo.Outbox
+	leases   *lease.Manager
+	bus      Bus
+	interval time.Duration
+	logger   *slog.Logger
+	done     sync.WaitGroup
+}
+
+// NewRelay returns a Relay polling every interval until ctx is done.
+func NewRelay(ctx context.Context, outbox repo.Outbox, bus Bus, leases *lease.Manager, interval time.Duration, logger *slog.Logger) *Relay {
+	return &Relay{ctx: ctx, outbox: outbox, bus: bus, leases: leases, interval: interval, logger: logger}
+}
+
+func (r *Relay) Start() {
+	r.done.Add(1)
+	go func() {
+		defer r.done.Done()
+		for {
+			r.relay()
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-time.After(r.interval):
+			}
+		}
+	}()
+}
+
+// Wait blocks until the batch in flight is published.
+func (r *Relay) Wait() {
+	r.done.Wait()
+}
+
+// relay publishes a batch under the context of the lease, stopping once the
+// lease is lost so a replica that took it over does not publish alongside.
+func (r *Relay) relay() {
+	ctx, ok := r.leases.Acquire("outbox-relay")
+	if !ok {
+		return
+	}
+	unpublished, err := r.outbox.ListUnpublished(ctx, 100)
+	if err != nil {
+		r.logger.Error("listing outbox failed", "error", err)
+		return
+	}
+	for _, event := range unpublished {
+		if ctx.Err() != nil {
+			return
+		}
+		r.publish(ctx, event)
+	}
+}
+
+func (r *Relay) publish(ctx context.Context, event *model.OutboxEvent) {
+	err := r.bus.Publish(ctx, Event{
+		ID:             event.ID,
+		Type:           event.Type,
+		OrganizationID: event.OrganizationID,
+		CreatedAt:      event.CreatedAt,
+		Data:           json.RawMessage(event.Payload),
+	})
+	event.Attempts++
+	if err != nil {
+		event.Error = err.Error()
+		metrics.OutboxEvents.WithLabelValues(event.Type, "error").Inc()
+		r.logger.Warn("publishing event failed", "event", event.ID, "type", event.Type, "attempts", event.Attempts, "error", err)
+	} else {
+		event.Error = ""
+		event.PublishedAt = model.FNow()
+		metrics.OutboxEvents.WithLabelValues(event.Type, "published").Inc()
+	}
+	if err := r.outbox.Save(ctx, event); err != nil {
+		r.logger.Error("saving outbox event failed", "event", event.ID, "error", err)
+	}
+}
@@ -0,0 +1,44 @@
+package events
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/alterminal/member/lease"
+	"github.com/alterminal/member/model"
+	"github.com/alterminal/member/repo"
+)
+
+type releasingBus struct {
+	leases    *lease.Manager
+	published []string
+}
+
+func (b *releasingBus) Publish(ctx context.Context, event Event) error {
+	b.published = append(b.published, event.ID)
+	b.leases.Release("outbox-relay")
+	return nil
+}
+
+// TestRelayStopsWhenLeaseIsLost checks that the relay publishes nothing more
+// of its batch once the lease is gone.
+func TestRelayStopsWhenLeaseIsLost(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repos := repo.NewMemory()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	leases := lease.New(ctx, repos.Leases, time.Minute, logger)
+	for range 2 {
+		if err := repos.Outbox.Add(ctx, &model.OutboxEvent{Type: "test", Payload: "{}"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bus := &releasingBus{leases: leases}
+	NewRelay(ctx, repos.Outbox, bus, leases, time.Minute, logger).relay()
+	if len(bus.published) != 1 {
+		t.Errorf("published = %v, want one event", bus.published)
+	}
+}
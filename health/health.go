@@ -0,0 +1,79 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Check func(ctx context.Context) error
+
+type Status struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Health answers liveness and readiness probes. The service is ready when it
+// has not been marked otherwise and every dependency check passes.
+type Health struct {
+	Timeout  time.Duration
+	notReady atomic.Bool
+	names    []string
+	checks   map[string]Check
+}
+
+func New(timeout time.Duration) *Health {
+	return &Health{Timeout: timeout, checks: map[string]Check{}}
+}
+
+func (h *Health) Add(name string, check Check) {
+	h.names = append(h.names, name)
+	h.checks[name] = check
+}
+
+// SetReady flips readiness, for instance off while shutting down.
+func (h *Health) SetReady(ready bool) {
+	h.notReady.Store(!ready)
+}
+
+func (h *Health) Liveness(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, Status{Status: "ok"})
+}
+
+func (h *Health) Readiness(ctx *gin.Context) {
+	checkCtx, cancel := context.WithTimeout(ctx.Request.Context(), h.Timeout)
+	defer cancel()
+	results := make([]Status, len(h.names))
+	var wg sync.WaitGroup
+	for i, name := range h.names {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = Status{Status: "ok"}
+			if err := check(checkCtx); err != nil {
+				results[i] = Status{Status: "error", Error: err.Error()}
+			}
+		}(i, h.checks[name])
+	}
+	wg.Wait()
+	status := "ok"
+	checks := map[string]Status{}
+	for i, name := range h.names {
+		checks[name] = results[i]
+		if results[i].Status != "ok" {
+			status = "unavailable"
+		}
+	}
+	if h.notReady.Load() {
+		status = "shutting_down"
+	}
+	code := http.StatusOK
+	if status != "ok" {
+		code = http.StatusServiceUnavailable
+	}
+	ctx.JSON(code, gin.H{"status": status, "checks": checks})
+}
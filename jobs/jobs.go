@@ -0,0 +1,253 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/alterminal/member/lease"
+	"github.com/alterminal/member/metrics"
+	"github.com/alterminal/member/model"
+	"github.com/alterminal/member/repo"
+)
+
+// Handler runs one attempt of a job. Returning Later reschedules the job
+// without counting a failed attempt.
+type Handler func(ctx context.Context, job *model.Job) error
+
+type later struct {
+	after time.Duration
+}
+
+func (l *later) Error() string {
+	return fmt.Sprintf("run again in %s", l.after)
+}
+
+// Later tells the scheduler that the job is not done yet and should run
+// again after the given delay.
+func Later(after time.Duration) error {
+	return &later{after: after}
+}
+
+// maxBackoff caps the delay between retries.
+const maxBackoff = time.Hour
+
+// backoff returns the delay before retrying a job that failed attempts times:
+// base, doubled for every failed attempt after the first, up to maxBackoff.
+func backoff(base time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackoff)
+}
+
+type Config struct {
+	// Workers bounds how many jobs run at once.
+	Workers     int
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled for every later
+	// one up to an hour.
+	Backoff      time.Duration
+	PollInterval time.Duration
+}
+
+// Schedule adds a job of jobType for subject, to run at runAt, unless one
+// exists already. Pass the Jobs of a transaction to schedule the job with
+// the change that needs it.
+func Schedule(ctx context.Context, jobs repo.Jobs, jobType, subject string, payload any, runAt time.Time) error {
+	job := model.Job{Type: jobType, Subject: subject, Status: model.JobPending, RunAt: &runAt}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		job.Payload = string(data)
+	}
+	_, err := jobs.Add(ctx, &job)
+	return err
+}
+
+// Scheduler runs the due jobs of the database on a bounded pool of workers.
+// Only the replica holding the scheduler lease runs jobs, and it stops them
+// once the lease is lost. A finished job frees its worker for the next due
+// one at once, without waiting for the others it was listed with.
+type Scheduler struct {
+	ctx      context.Context
+	config   Config
+	logger   *slog.Logger
+	jobs     repo.Jobs
+	leases   *lease.Manager
+	handlers map[string]Handler
+	wake     chan struct{}
+	mu       sync.Mutex
+	running  map[string]bool
+	done     sync.WaitGroup
+}
+
+// New returns a Scheduler whose jobs stop once ctx is done.
+func New(ctx context.Context, jobs repo.Jobs, config Config, leases *lease.Manager, logger *slog.Logger) *Scheduler {
+	return &Scheduler{
+		ctx:      ctx,
+		config:   config,
+		logger:   logger,
+		jobs:     jobs,
+		leases:   leases,
+		handlers: map[string]Handler{},
+		wake:     make(chan struct{}, 1),
+		running:  map[string]bool{},
+	}
+}
+
+// Handle runs the jobs of jobType with handler. Register handlers before
+// calling Start.
+func (s *Scheduler) Handle(jobType string, handler Handler) {
+	s.handlers[jobType] = handler
+}
+
+// Retry runs job again as soon as possible with fresh attempts. It returns
+// repo.ErrStale when job changed since it was read.
+func (s *Scheduler) Retry(ctx context.Context, job *model.Job) error {
+	job.Status = model.JobPending
+	job.Attempts = 0
+	job.Error = ""
+	job.RunAt = model.FNow()
+	job.FinishedAt = nil
+	if err := s.jobs.Save(ctx, job); err != nil {
+		return err
+	}
+	s.notify()
+	return nil
+}
+
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start runs due jobs until the context of s is done.
+func (s *Scheduler) Start() {
+	s.done.Add(1)
+	go func() {
+		defer s.done.Done()
+		for {
+			s.runDue()
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-s.wake:
+			case <-time.After(s.config.PollInterval):
+			}
+		}
+	}()
+}
+
+// Wait blocks until the jobs in flight are finished.
+func (s *Scheduler) Wait() {
+	s.done.Wait()
+}
+
+// runDue starts due jobs on the free workers, under the context of the
+// lease.
+func (s *Scheduler) runDue() {
+	if s.ctx.Err() != nil {
+		return
+	}
+	ctx, ok := s.leases.Acquire("job-scheduler")
+	if !ok {
+		return
+	}
+	// Holding the lock while listing keeps a job that finishes meanwhile in
+	// running, so the listing cannot start it again from its state before.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	free := s.config.Workers - len(s.running)
+	if free <= 0 {
+		return
+	}
+	due, err := s.jobs.ListDue(ctx, time.Now(), free+len(s.running))
+	if err != nil {
+		s.logger.Error("listing due jobs failed", "error", err)
+		return
+	}
+	for _, job := range due {
+		if free == 0 {
+			return
+		}
+		if s.running[job.ID] {
+			continue
+		}
+		free--
+		s.running[job.ID] = true
+		s.done.Add(1)
+		go func() {
+			defer s.done.Done()
+			s.run(ctx, job)
+			s.mu.Lock()
+			delete(s.running, job.ID)
+			s.mu.Unlock()
+			s.notify()
+		}()
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, job *model.Job) {
+	logger := s.logger.With("job", job.ID, "type", job.Type, "subject", job.Subject)
+	handler, ok := s.handlers[job.Type]
+	err := fmt.Errorf("no handler for job type %q", job.Type)
+	if ok {
+		err = handler(ctx, job)
+	}
+	// Jobs interrupted by shutdown or by losing the lease run again later.
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+	var again *later
+	result := model.JobSucceeded
+	switch {
+	case err == nil:
+		job.Status = model.JobSucceeded
+		job.Attempts = 0
+		job.RunAt = nil
+		job.FinishedAt = model.FNow()
+		job.Error = ""
+	case errors.As(err, &again):
+		result = "later"
+		next := time.Now().Add(again.after)
+		job.RunAt = &next
+		job.Attempts = 0
+		job.Error = ""
+	default:
+		job.Attempts++
+		job.Error = err.Error()
+		if job.Attempts >= s.config.MaxAttempts {
+			result = model.JobFailed
+			job.Status = model.JobFailed
+			job.RunAt = nil
+			job.FinishedAt = model.FNow()
+		} else {
+			result = "retry"
+			next := time.Now().Add(backoff(s.config.Backoff, job.Attempts))
+			job.RunAt = &next
+		}
+	}
+	metrics.Jobs.WithLabelValues(job.Type, result).Inc()
+	err = s.jobs.Save(ctx, job)
+	if errors.Is(err, repo.ErrStale) {
+		logger.Warn("job changed while running, dropping its result", "result", result)
+		return
+	}
+	if err != nil {
+		logger.Error("saving job failed", "error", err)
+		return
+	}
+	if result == "retry" || result == model.JobFailed {
+		logger.Warn("job failed", "attempts", job.Attempts, "status", job.Status, "error", job.Error)
+	}
+}
@@ -0,0 +1,76 @@
+package jobs
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/alterminal/member/lease"
+	"github.com/alterminal/member/model"
+	"github.com/alterminal/member/repo"
+)
+
+// TestSlowJobDoesNotHoldOthers checks that free workers take jobs that became
+// due while a job listed before is still running.
+func TestSlowJobDoesNotHoldOthers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	repos := repo.NewMemory()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	leases := lease.New(ctx, repos.Leases, time.Minute, logger)
+	scheduler := New(ctx, repos.Jobs, Config{Workers: 2, MaxAttempts: 1, PollInterval: time.Hour}, leases, logger)
+	release := make(chan struct{})
+	scheduler.Handle("slow", func(ctx context.Context, job *model.Job) error {
+		<-release
+		return nil
+	})
+	fast := make(chan string, 2)
+	scheduler.Handle("fast", func(ctx context.Context, job *model.Job) error {
+		fast <- job.Subject
+		return nil
+	})
+	now := time.Now()
+	if err := Schedule(ctx, repos.Jobs, "slow", "slow", nil, now.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := Schedule(ctx, repos.Jobs, "fast", "listed", nil, now); err != nil {
+		t.Fatal(err)
+	}
+	scheduler.Start()
+	awaitFast := func(subject string) {
+		select {
+		case <-fast:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("job %s waited for the slow one", subject)
+		}
+	}
+	awaitFast("listed")
+	if err := Schedule(ctx, repos.Jobs, "fast", "later", nil, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	scheduler.notify()
+	awaitFast("later")
+	close(release)
+	cancel()
+	scheduler.Wait()
+}
+
+func TestBackoff(t *testing.T) {
+	for _, test := range []struct {
+		attempts int
+		delay    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{13, maxBackoff},
+		{64, maxBackoff},
+		{100, maxBackoff},
+		{1 << 30, maxBackoff},
+	} {
+		if delay := backoff(time.Second, test.attempts); delay != test.delay {
+			t.Errorf("backoff after %d attempts = %s, want %s", test.attempts, delay, test.delay)
+		}
+	}
+}
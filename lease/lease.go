@@ -0,0 +1,156 @@
+package lease
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/alterminal/member/repo"
+)
+
+// Manager takes leases in the database on behalf of one replica and renews
+// them until released, so that work guarded by a lease runs on a single
+// replica and moves to another one when this replica dies.
+type Manager struct {
+	ctx    context.Context
+	leases repo.Leases
+	holder string
+	ttl    time.Duration
+	logger *slog.Logger
+	mu     sync.Mutex
+	held   map[string]context.Context
+	cancel map[string]context.CancelFunc
+	done   sync.WaitGroup
+}
+
+// New returns a Manager renewing its leases every third of ttl until ctx is
+// done.
+func New(ctx context.Context, leases repo.Leases, ttl time.Duration, logger *slog.Logger) *Manager {
+	m := &Manager{
+		ctx:    ctx,
+		leases: leases,
+		holder: holder(),
+		ttl:    ttl,
+		logger: logger,
+		held:   map[string]context.Context{},
+		cancel: map[string]context.CancelFunc{},
+	}
+	m.logger.Info("lease holder", "holder", m.holder)
+	m.done.Add(1)
+	go func() {
+		defer m.done.Done()
+		m.heartbeat()
+	}()
+	return m
+}
+
+func holder() string {
+	host, _ := os.Hostname()
+	random := make([]byte, 4)
+	rand.Read(random)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(random))
+}
+
+// Acquire takes the lease name unless another replica holds it. The
+// returned context is canceled once the lease is lost or released.
+func (m *Manager) Acquire(name string) (context.Context, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if ctx, ok := m.held[name]; ok {
+		return ctx, true
+	}
+	now := time.Now()
+	ok, err := m.leases.Acquire(m.ctx, name, m.holder, now.Add(m.ttl), now)
+	if err != nil {
+		m.logger.Error("acquiring lease failed", "lease", name, "error", err)
+		return nil, false
+	}
+	if !ok {
+		return nil, false
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.held[name] = ctx
+	m.cancel[name] = cancel
+	return ctx, true
+}
+
+// Release gives up the lease name, letting another replica take it at once.
+func (m *Manager) Release(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cancel, ok := m.cancel[name]
+	if !ok {
+		return
+	}
+	cancel()
+	delete(m.held, name)
+	delete(m.cancel, name)
+	// The context of m may be done already when releasing on shutdown.
+	ctx, cancelRelease := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelRelease()
+	if err := m.leases.Release(ctx, name, m.holder); err != nil {
+		m.logger.Warn("releasing lease failed", "lease", name, "error", err)
+	}
+}
+
+// Wait blocks until the heartbeat has stopped and releases the leases still
+// held. Call it once the work guarded by them is finished.
+func (m *Manager) Wait() {
+	m.done.Wait()
+	m.mu.Lock()
+	var names []string
+	for name := range m.held {
+		names = append(names, name)
+	}
+	m.mu.Unlock()
+	for _, name := range names {
+		m.Release(name)
+	}
+}
+
+// heartbeat renews the leases and cancels the ones that were taken over, or
+// all of them once renewing has failed for half of a lease, well before the
+// database lets another replica take them.
+func (m *Manager) heartbeat() {
+	renewed := time.Now()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-time.After(m.ttl / 3):
+		}
+		// Holding the lock keeps leases acquired meanwhile out of the check.
+		m.mu.Lock()
+		now := time.Now()
+		deadline := renewed.Add(m.ttl / 2)
+		// A renewal that hangs must not hold the leases past the deadline.
+		ctx, cancel := context.WithDeadline(m.ctx, deadline)
+		names, err := m.leases.Renew(ctx, m.holder, now.Add(m.ttl))
+		cancel()
+		if err != nil {
+			m.logger.Error("renewing leases failed", "error", err)
+			if time.Now().Before(deadline) {
+				m.mu.Unlock()
+				continue
+			}
+			names = nil
+		} else {
+			renewed = now
+		}
+		for name, cancel := range m.cancel {
+			if !slices.Contains(names, name) {
+				m.logger.Warn("lease lost", "lease", name)
+				cancel()
+				delete(m.held, name)
+				delete(m.cancel, name)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
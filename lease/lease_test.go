@@ -0,0 +1,41 @@
+package lease
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/alterminal/member/repo"
+)
+
+type failingLeases struct {
+	repo.Leases
+}
+
+func (l failingLeases) Renew(ctx context.Context, holder string, expiresAt time.Time) ([]string, error) {
+	return nil, errors.New("database unavailable")
+}
+
+// TestFailedRenewCancelsBeforeExpiry checks that a replica that cannot renew
+// stops its work before another replica can take the lease.
+func TestFailedRenewCancelsBeforeExpiry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ttl := 300 * time.Millisecond
+	manager := New(ctx, failingLeases{repo.NewMemory().Leases}, ttl, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	expiresAt := time.Now().Add(ttl)
+	leaseCtx, ok := manager.Acquire("test")
+	if !ok {
+		t.Fatal("lease not acquired")
+	}
+	select {
+	case <-leaseCtx.Done():
+	case <-time.After(time.Until(expiresAt)):
+		t.Fatal("lease context still running when the lease expired")
+	}
+	cancel()
+	manager.Wait()
+}
@@ -1,46 +1,275 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	authApi "github.com/alterminal/auth/api"
 	"github.com/alterminal/auth/sdk"
+	"github.com/alterminal/member/accounts"
 	"github.com/alterminal/member/api"
+	"github.com/alterminal/member/billing"
+	"github.com/alterminal/member/cli"
+	"github.com/alterminal/member/config"
+	"github.com/alterminal/member/events"
+	"github.com/alterminal/member/health"
+	"github.com/alterminal/member/jobs"
+	"github.com/alterminal/member/lease"
+	"github.com/alterminal/member/metrics"
+	"github.com/alterminal/member/payment"
+	"github.com/alterminal/member/ratelimit"
 	"github.com/alterminal/member/repo"
-	"github.com/spf13/viper"
-	"github.com/stripe/stripe-go/v81"
+	"github.com/alterminal/member/tracing"
+	"github.com/alterminal/member/webhook"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
-func init() {
-	path := os.Getenv("config")
-	if path == "" {
-		path = "."
-	}
-	fmt.Println(path)
-	viper.AddConfigPath(".")
-	viper.SetConfigName(".env")
-	viper.SetConfigType("yaml")
-	viper.ReadInConfig()
-	stripe.Key = viper.GetString("stripe.key")
+func dialector(config config.DatabaseConfig) gorm.Dialector {
+	switch config.Driver {
+	case "postgres":
+		dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+			config.Host,
+			config.Port,
+			config.User,
+			config.Password,
+			config.Database,
+			config.SslMode)
+		return postgres.Open(dsn)
+	case "sqlite":
+		return sqlite.Open(config.Database)
+	}
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		config.User,
+		config.Password,
+		config.Host,
+		config.Port,
+		config.Database)
+	return mysql.Open(dsn)
+}
+
+// logLevel is shared by every handler so that reloading log.level applies to
+// loggers already handed out.
+var logLevel slog.LevelVar
+
+func newLogger(config config.LogConfig) *slog.Logger {
+	logLevel.UnmarshalText([]byte(config.Level))
+	options := &slog.HandlerOptions{Level: &logLevel}
+	if config.Format == "text" {
+		return slog.New(slog.NewTextHandler(os.Stderr, options))
+	}
+	return slog.New(slog.NewJSONHandler(os.Stderr, options))
+}
+
+func corsConfig(config config.CorsPolicyConfig) api.CORSConfig {
+	return api.CORSConfig{
+		Origins:     config.Origins,
+		Headers:     config.Headers,
+		Methods:     config.Methods,
+		Credentials: config.Credentials,
+		MaxAge:      config.MaxAge,
+	}
+}
+
+func limit(config config.LimitConfig) ratelimit.Limit {
+	return ratelimit.Limit{Rate: config.Rate, Burst: config.Burst}
+}
+
+func rateLimit(config config.RateLimitGroupConfig) api.RateLimit {
+	return api.RateLimit{
+		IP:           limit(config.IP),
+		Account:      limit(config.Account),
+		Organization: limit(config.Organization),
+	}
+}
+
+func accountProvider(config config.AuthConfig) (accounts.AccountProvider, error) {
+	if config.Provider == "memory" {
+		provider := accounts.NewMemory()
+		admin, err := provider.CreateAccount(context.Background(), authApi.CreateAccountRequest{
+			Namespace: "admin",
+			Email:     config.AdminEmail,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if token := config.AdminToken; token != "" {
+			provider.AddToken(token, admin.ID)
+		}
+		return provider, nil
+	}
+	return &accounts.Sdk{
+		Client: sdk.Client{
+			BaseUrl:     config.BaseUrl,
+			AccessToken: config.AccessToken,
+		},
+	}, nil
 }
 
 func main() {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		viper.GetString("database.user"),
-		viper.GetString("database.password"),
-		viper.GetString("database.host"),
-		viper.GetString("database.port"),
-		viper.GetString("database.database"))
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	if len(os.Args) > 1 && cli.IsCommand(os.Args[1]) {
+		if err := cli.Run(context.Background(), os.Args[1:], os.Stdin, os.Stdout); err != nil {
+			if err != cli.ErrUsage {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			os.Exit(1)
+		}
+		return
+	}
+	path := os.Getenv("config")
+	cfg, err := config.Load(path)
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, "invalid configuration:")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	logger := newLogger(cfg.Log)
+	slog.SetDefault(logger)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		logger.Error("setting up tracing failed", "error", err)
+		os.Exit(1)
+	}
+	db, err := gorm.Open(dialector(cfg.Database), &gorm.Config{})
+	if err != nil {
+		logger.Error("opening database failed", "error", err)
+		os.Exit(1)
+	}
+	if err := db.Use(metrics.GormPlugin{}); err != nil {
+		logger.Error("registering metrics failed", "error", err)
+		os.Exit(1)
 	}
-	authClient := sdk.Client{
-		BaseUrl:     viper.GetString("auth.baseUrl"),
-		AccessToken: viper.GetString("auth.accessToken"),
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		logger.Error("registering tracing failed", "error", err)
+		os.Exit(1)
 	}
 	repo.Init(db)
-	api.Run(db, authClient)
+	repos := repo.NewGorm(db)
+	stripe := payment.NewStripe(cfg.Stripe.Key)
+	gateways := payment.Gateways{
+		"stripe": payment.Instrument("stripe", stripe),
+	}
+	leases := lease.New(ctx, repos.Leases, cfg.Lease.TTL, logger)
+	webhooks := webhook.New(ctx, repos, webhook.Config{
+		Timeout:      cfg.Webhooks.Timeout,
+		MaxAttempts:  cfg.Webhooks.MaxAttempts,
+		Backoff:      cfg.Webhooks.Backoff,
+		PollInterval: cfg.Webhooks.PollInterval,
+	}, leases, logger)
+	webhooks.Start()
+	scheduler := jobs.New(ctx, repos.Jobs, jobs.Config{
+		Workers:      cfg.Jobs.Workers,
+		MaxAttempts:  cfg.Jobs.MaxAttempts,
+		Backoff:      cfg.Jobs.Backoff,
+		PollInterval: cfg.Jobs.PollInterval,
+	}, leases, logger)
+	billing := billing.New(repos, gateways, scheduler, logger)
+	billing.SetWatchInterval(cfg.Billing.WatchInterval)
+	billing.SetCheckoutTTL(cfg.Billing.CheckoutTTL)
+	bus := events.NewMemory()
+	bus.Subscribe(webhooks.Handle)
+	relay := events.NewRelay(ctx, repos.Outbox, bus, leases, cfg.Outbox.PollInterval, logger)
+	relay.Start()
+	if err := billing.WatchPending(ctx); err != nil {
+		logger.Error("scheduling pending subscriptions failed", "error", err)
+	}
+	scheduler.Start()
+	provider, err := accountProvider(cfg.Auth)
+	if err != nil {
+		logger.Error("creating admin account failed", "error", err)
+		os.Exit(1)
+	}
+	accountCache := accounts.NewCache(accounts.Instrument(provider), accounts.CacheConfig{
+		Size:        cfg.Auth.Cache.Size,
+		TTL:         cfg.Auth.Cache.TTL,
+		NegativeTTL: cfg.Auth.Cache.NegativeTTL,
+		JwtSecret:   cfg.Auth.JwtSecret,
+	})
+	health := health.New(cfg.Health.Timeout)
+	health.Add("database", func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	})
+	health.Add("migrations", func(ctx context.Context) error {
+		return repo.Migrated(db.WithContext(ctx))
+	})
+	health.Add("auth", func(ctx context.Context) error {
+		return accounts.Ping(ctx, accountCache)
+	})
+	cors := api.NewCORS(corsConfig(cfg.Cors.Public), corsConfig(cfg.Cors.Tenant), corsConfig(cfg.Cors.Admin))
+	rateLimits := api.NewRateLimits(ratelimit.NewMemory(), rateLimit(cfg.RateLimit.Public), rateLimit(cfg.RateLimit.Tenant), rateLimit(cfg.RateLimit.Admin))
+	router := api.NewRouter(repos, billing, webhooks, scheduler, accountCache, api.Options{
+		Health:         health,
+		CORS:           cors,
+		RateLimits:     rateLimits,
+		TrustedProxies: cfg.Server.TrustedProxies,
+		Logger:         logger,
+	})
+	config.Watch(path, cfg, logger, func(next *config.Config) {
+		logLevel.UnmarshalText([]byte(next.Log.Level))
+		stripe.SetKey(next.Stripe.Key)
+		billing.SetWatchInterval(next.Billing.WatchInterval)
+		billing.SetCheckoutTTL(next.Billing.CheckoutTTL)
+		cors.Public.Set(corsConfig(next.Cors.Public))
+		cors.Tenant.Set(corsConfig(next.Cors.Tenant))
+		cors.Admin.Set(corsConfig(next.Cors.Admin))
+		rateLimits.Public.Set(rateLimit(next.RateLimit.Public))
+		rateLimits.Tenant.Set(rateLimit(next.RateLimit.Tenant))
+		rateLimits.Admin.Set(rateLimit(next.RateLimit.Admin))
+	})
+	// Report not ready first so that load balancers stop routing here before
+	// the listener closes.
+	serveCtx, cancelServe := context.WithCancel(context.Background())
+	defer cancelServe()
+	go func() {
+		<-ctx.Done()
+		logger.Info("shutting down")
+		health.SetReady(false)
+		time.Sleep(cfg.Server.DrainDelay)
+		cancelServe()
+	}()
+	logger.Info("listening", "addr", cfg.Server.Addr)
+	// A server that could not serve, such as on a port already in use, still
+	// shuts down the rest before exiting with a failure.
+	failed := false
+	if err := api.Run(serveCtx, router, cfg.Server.Addr, cfg.Server.ShutdownTimeout); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("server stopped", "error", err)
+		failed = true
+	}
+	stop()
+	relay.Wait()
+	scheduler.Wait()
+	webhooks.Wait()
+	leases.Wait()
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancelFlush()
+	if err := shutdownTracing(flushCtx); err != nil {
+		logger.Error("flushing traces failed", "error", err)
+	}
+	if failed {
+		cancelFlush()
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "member"
+
+var (
+	HttpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route and status.",
+	}, []string{"method", "route", "status"})
+	HttpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	DbQueries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_queries_total",
+		Help:      "Database statements by operation, table and result.",
+	}, []string{"operation", "table", "result"})
+	DbDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Database statement latency by operation and table.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "table"})
+
+	AuthRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_requests_total",
+		Help:      "Calls to the account provider by method and result.",
+	}, []string{"method", "result"})
+	AuthDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "auth_request_duration_seconds",
+		Help:      "Account provider call latency by method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	PaymentRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "payment_requests_total",
+		Help:      "Calls to payment gateways by gateway, method and result.",
+	}, []string{"gateway", "method", "result"})
+	PaymentDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "payment_request_duration_seconds",
+		Help:      "Payment gateway call latency by gateway and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"gateway", "method"})
+
+	Subscriptions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "subscriptions_total",
+		Help:      "Subscription lifecycle events by gateway.",
+	}, []string{"gateway", "event"})
+	RateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "Requests rejected by a rate limit, by route group and bucket kind.",
+	}, []string{"group", "kind"})
+	WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Webhook delivery attempts by event and result.",
+	}, []string{"event", "result"})
+	OutboxEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "outbox_events_total",
+		Help:      "Outbox events relayed to the event bus by type and result.",
+	}, []string{"type", "result"})
+	Jobs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_total",
+		Help:      "Job runs by type and result.",
+	}, []string{"type", "result"})
+)
+
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// ObserveAuth records a call to the account provider started at start.
+func ObserveAuth(method string, start time.Time, err error) {
+	AuthRequests.WithLabelValues(method, Result(err)).Inc()
+	AuthDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// ObservePayment records a call to a payment gateway started at start.
+func ObservePayment(gateway, method string, start time.Time, err error) {
+	PaymentRequests.WithLabelValues(gateway, method, Result(err)).Inc()
+	PaymentDuration.WithLabelValues(gateway, method).Observe(time.Since(start).Seconds())
+}
+
+// Middleware records every request under its route pattern. Requests that
+// match no route share the "unmatched" label to bound cardinality.
+func Middleware(ctx *gin.Context) {
+	start := time.Now()
+	ctx.Next()
+	route := ctx.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	status := strconv.Itoa(ctx.Writer.Status())
+	HttpRequests.WithLabelValues(ctx.Request.Method, route, status).Inc()
+	HttpDuration.WithLabelValues(ctx.Request.Method, route, status).Observe(time.Since(start).Seconds())
+}
+
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
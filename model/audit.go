@@ -0,0 +1,39 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrAuditAppendOnly = errors.New("audit entries cannot be changed")
+
+// AuditEntry records one change made through the API. Before and After hold
+// only the fields that changed.
+type AuditEntry struct {
+	ID             string         `json:"id" gorm:"type:char(19);primaryKey"`
+	CreatedAt      time.Time      `json:"createdAt" gorm:"index"`
+	ActorID        string         `json:"actorId" gorm:"type:char(19);index"`
+	OrganizationID string         `json:"organizationId" gorm:"type:char(19);index"`
+	Action         string         `json:"action" gorm:"type:varchar(64);index"`
+	TargetType     string         `json:"targetType" gorm:"type:varchar(64)"`
+	TargetID       string         `json:"targetId" gorm:"type:varchar(64);index"`
+	Before         map[string]any `json:"before" gorm:"type:text;serializer:json"`
+	After          map[string]any `json:"after" gorm:"type:text;serializer:json"`
+	IP             string         `json:"ip" gorm:"type:varchar(45)"`
+	RequestID      string         `json:"requestId" gorm:"type:varchar(64)"`
+}
+
+func (a *AuditEntry) BeforeCreate(tx *gorm.DB) error {
+	a.ID = NewID()
+	return nil
+}
+
+func (a *AuditEntry) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditAppendOnly
+}
+
+func (a *AuditEntry) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditAppendOnly
+}
@@ -1,6 +1,17 @@
 package model
 
-import "gorm.io/gorm"
+import (
+	"errors"
+
+	"github.com/bwmarrin/snowflake"
+	"gorm.io/gorm"
+)
+
+var node, _ = snowflake.NewNode(0)
+
+func NewID() string {
+	return node.Generate().String()
+}
 
 type Pagination[T any] struct {
 	Items []T `json:"items"`
@@ -10,9 +21,14 @@ type Pagination[T any] struct {
 	Total int `json:"total"`
 }
 
+var ErrInvalidPage = errors.New("limit must be positive and page must not be negative")
+
 type Option func(*gorm.DB) *gorm.DB
 
 func ListByOption[T any](db *gorm.DB, limit, page int, opts ...Option) (Pagination[*T], error) {
+	if limit < 1 || page < 0 {
+		return Pagination[*T]{}, ErrInvalidPage
+	}
 	var ts []*T
 	db = db.Model(&ts)
 	for _, opt := range opts {
@@ -0,0 +1,38 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	JobPending   = "pending"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Job is background work run by the scheduler, retried with backoff until it
+// succeeds or runs out of attempts. A type has at most one job per Subject,
+// the id of what the job works on.
+type Job struct {
+	ID      string `json:"id" gorm:"type:char(19);primaryKey"`
+	Type    string `json:"type" gorm:"type:varchar(64);uniqueIndex:idx_jobs_type_subject"`
+	Subject string `json:"subject" gorm:"type:varchar(128);uniqueIndex:idx_jobs_type_subject"`
+	Payload string `json:"payload" gorm:"type:text"`
+	Status  string `json:"status" gorm:"type:varchar(16);index"`
+	// Attempts counts the attempts failed in a row.
+	Attempts   int        `json:"attempts"`
+	Error      string     `json:"error" gorm:"type:text"`
+	RunAt      *time.Time `json:"runAt" gorm:"index"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	FinishedAt *time.Time `json:"finishedAt"`
+	// Version counts the saves of the job, so that a save can tell whether
+	// the job changed since it was read.
+	Version int `json:"-"`
+}
+
+func (a *Job) BeforeCreate(tx *gorm.DB) error {
+	a.ID = NewID()
+	return nil
+}
@@ -0,0 +1,10 @@
+package model
+
+import "time"
+
+// Lease gives Holder exclusive use of the named work until ExpiresAt.
+type Lease struct {
+	Name      string    `json:"name" gorm:"type:varchar(128);primaryKey"`
+	Holder    string    `json:"holder" gorm:"type:varchar(255);index"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
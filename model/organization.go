@@ -1,13 +1,13 @@
 package model
 
-import (
-	"github.com/bwmarrin/snowflake"
-	"gorm.io/gorm"
-)
+import "gorm.io/gorm"
 
 type Organization struct {
 	ID   string `json:"id" gorm:"type:char(19);primaryKey"`
 	Name string `json:"name" gorm:"type:varchar(255)"`
+	// AllowedOrigins may call the public and tenant routes of the
+	// organization from a browser, on top of the configured CORS origins.
+	AllowedOrigins []string `json:"allowedOrigins" gorm:"type:text;serializer:json"`
 }
 
 func (a *Organization) BeforeDelete(tx *gorm.DB) error {
@@ -17,8 +17,7 @@ func (a *Organization) BeforeDelete(tx *gorm.DB) error {
 }
 
 func (a *Organization) BeforeCreate(tx *gorm.DB) error {
-	node, _ := snowflake.NewNode(0)
-	a.ID = node.Generate().String()
+	a.ID = NewID()
 	return nil
 }
 
@@ -34,8 +33,7 @@ func (a *Role) BeforeDelete(tx *gorm.DB) error {
 }
 
 func (a *Role) BeforeCreate(tx *gorm.DB) error {
-	node, _ := snowflake.NewNode(0)
-	a.ID = node.Generate().String()
+	a.ID = NewID()
 	return nil
 }
 
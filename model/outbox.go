@@ -0,0 +1,25 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OutboxEvent is a domain event written in the transaction of the change it
+// describes and published by the relay once committed.
+type OutboxEvent struct {
+	ID             string     `json:"id" gorm:"type:char(19);primaryKey"`
+	Type           string     `json:"type" gorm:"type:varchar(64)"`
+	OrganizationID string     `json:"organizationId" gorm:"type:char(19)"`
+	Payload        string     `json:"payload" gorm:"type:text"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	PublishedAt    *time.Time `json:"publishedAt" gorm:"index"`
+	Attempts       int        `json:"attempts"`
+	Error          string     `json:"error" gorm:"type:text"`
+}
+
+func (a *OutboxEvent) BeforeCreate(tx *gorm.DB) error {
+	a.ID = NewID()
+	return nil
+}
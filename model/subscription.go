@@ -0,0 +1,82 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	SubscriptionPending  = "pending"
+	SubscriptionTrialing = "trialing"
+	SubscriptionActive   = "active"
+	SubscriptionPastDue  = "past_due"
+	SubscriptionPaused   = "paused"
+	SubscriptionCanceled = "canceled"
+	SubscriptionExpired  = "expired"
+)
+
+var ErrInvalidTransition = errors.New("invalid subscription status transition")
+
+// LiveSubscriptionStatuses are the statuses of a subscription that was
+// checked out and has not ended. A plan has at most one live subscription.
+var LiveSubscriptionStatuses = []string{
+	SubscriptionTrialing,
+	SubscriptionActive,
+	SubscriptionPastDue,
+	SubscriptionPaused,
+}
+
+// subscriptionTransitions lists the statuses each status can change to.
+// Canceled and expired subscriptions never change again.
+var subscriptionTransitions = map[string][]string{
+	SubscriptionPending:  {SubscriptionTrialing, SubscriptionActive, SubscriptionCanceled, SubscriptionExpired},
+	SubscriptionTrialing: {SubscriptionActive, SubscriptionPastDue, SubscriptionPaused, SubscriptionCanceled},
+	SubscriptionActive:   {SubscriptionPastDue, SubscriptionPaused, SubscriptionCanceled},
+	SubscriptionPastDue:  {SubscriptionActive, SubscriptionPaused, SubscriptionCanceled},
+	SubscriptionPaused:   {SubscriptionActive, SubscriptionPastDue, SubscriptionCanceled},
+}
+
+// Ended reports whether the subscription can no longer change.
+func (a *Subscription) Ended() bool {
+	return a.Status == SubscriptionCanceled || a.Status == SubscriptionExpired
+}
+
+// Transition moves the subscription to status and stamps the matching
+// timestamp. The checkout is completed by the first live status.
+func (a *Subscription) Transition(status string) error {
+	if !slices.Contains(subscriptionTransitions[a.Status], status) {
+		return fmt.Errorf("%w from %q to %q", ErrInvalidTransition, a.Status, status)
+	}
+	now := FNow()
+	switch status {
+	case SubscriptionCanceled:
+		a.CanceledAt = now
+	case SubscriptionExpired:
+		a.ExpiredAt = now
+	default:
+		if a.CompletedAt == nil {
+			a.CompletedAt = now
+		}
+	}
+	a.Status = status
+	return nil
+}
+
+// SubscriptionStatusChange records one status change of a subscription.
+// Previous is empty for the status a subscription is created with.
+type SubscriptionStatusChange struct {
+	ID             string    `json:"id" gorm:"type:char(19);primaryKey"`
+	SubscriptionID string    `json:"subscriptionId" gorm:"type:char(19);index"`
+	Previous       string    `json:"previous" gorm:"type:varchar(16)"`
+	Status         string    `json:"status" gorm:"type:varchar(16)"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+func (a *SubscriptionStatusChange) BeforeCreate(tx *gorm.DB) error {
+	a.ID = NewID()
+	return nil
+}
@@ -0,0 +1,74 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Domain events. Webhooks can subscribe to the ones in webhook.Events.
+const (
+	EventSubscriptionCreated   = "subscription.created"
+	EventSubscriptionCompleted = "subscription.completed"
+	EventSubscriptionCanceled  = "subscription.canceled"
+	EventSubscriptionExpired   = "subscription.expired"
+	EventConsumerCreated       = "consumer.created"
+	EventSpaceCreated          = "space.created"
+	EventSpaceUpdated          = "space.updated"
+	EventRoleCreated           = "role.created"
+	EventRoleDeleted           = "role.deleted"
+	EventRoleAccountAdded      = "role.account.added"
+
+	// EventSubscriptionStatusChanged is any other change of subscription
+	// status, such as becoming past due.
+	EventSubscriptionStatusChanged = "subscription.status.changed"
+)
+
+type Webhook struct {
+	ID             string   `json:"id" gorm:"type:char(19);primaryKey"`
+	OrganizationID string   `json:"organizationId" gorm:"type:char(19);index"`
+	URL            string   `json:"url" gorm:"type:varchar(2048)"`
+	Events         []string `json:"events" gorm:"type:text;serializer:json"`
+	// Secret signs the payloads. It is only shown when the webhook is created.
+	Secret    string    `json:"-" gorm:"type:varchar(64)"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (a *Webhook) BeforeCreate(tx *gorm.DB) error {
+	a.ID = NewID()
+	return nil
+}
+
+func (a *Webhook) BeforeDelete(tx *gorm.DB) error {
+	tx.Exec("DELETE FROM webhook_deliveries WHERE webhook_id = ?", a.ID)
+	return nil
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is one event sent to one webhook, retried until it
+// succeeds or runs out of attempts. Redelivering an event creates another
+// delivery with the same EventID.
+type WebhookDelivery struct {
+	ID             string     `json:"id" gorm:"type:char(19);primaryKey"`
+	WebhookID      string     `json:"webhookId" gorm:"type:char(19);index"`
+	EventID        string     `json:"eventId" gorm:"type:char(19)"`
+	Event          string     `json:"event" gorm:"type:varchar(64)"`
+	Payload        string     `json:"payload" gorm:"type:text"`
+	Status         string     `json:"status" gorm:"type:varchar(16);index"`
+	Attempts       int        `json:"attempts"`
+	ResponseStatus int        `json:"responseStatus"`
+	Error          string     `json:"error" gorm:"type:text"`
+	NextAttemptAt  *time.Time `json:"nextAttemptAt" gorm:"index"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	DeliveredAt    *time.Time `json:"deliveredAt"`
+}
+
+func (a *WebhookDelivery) BeforeCreate(tx *gorm.DB) error {
+	a.ID = NewID()
+	return nil
+}
@@ -0,0 +1,63 @@
+package payment
+
+import (
+	"context"
+	"time"
+
+	"github.com/alterminal/member/metrics"
+	"github.com/alterminal/member/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Instrument records the latency and errors of every call to gateway under
+// the given gateway name and traces it as a child of the caller's span.
+func Instrument(name string, gateway PaymentGateway) PaymentGateway {
+	return &instrumented{name: name, gateway: gateway}
+}
+
+type instrumented struct {
+	name    string
+	gateway PaymentGateway
+}
+
+// observe starts a span for a call and returns the function that records its
+// outcome.
+func (i *instrumented) observe(ctx context.Context, method string) (context.Context, func(error)) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "payment."+method,
+		attribute.String("payment.gateway", i.name),
+		attribute.String("payment.method", method),
+	)
+	return ctx, func(err error) {
+		metrics.ObservePayment(i.name, method, start, err)
+		tracing.End(span, err)
+	}
+}
+
+func (i *instrumented) CreateSubscription(ctx context.Context, itemName string, price int, currency string) (*Subscription, error) {
+	ctx, done := i.observe(ctx, "create_subscription")
+	sub, err := i.gateway.CreateSubscription(ctx, itemName, price, currency)
+	done(err)
+	return sub, err
+}
+
+func (i *instrumented) CancelSubscription(ctx context.Context, subscriptionId string) error {
+	ctx, done := i.observe(ctx, "cancel_subscription")
+	err := i.gateway.CancelSubscription(ctx, subscriptionId)
+	done(err)
+	return err
+}
+
+func (i *instrumented) RetrieveSubscription(ctx context.Context, subscriptionId string) (*Subscription, error) {
+	ctx, done := i.observe(ctx, "retrieve_subscription")
+	sub, err := i.gateway.RetrieveSubscription(ctx, subscriptionId)
+	done(err)
+	return sub, err
+}
+
+func (i *instrumented) CancelPayment(ctx context.Context, subscriptionId string) error {
+	ctx, done := i.observe(ctx, "cancel_payment")
+	err := i.gateway.CancelPayment(ctx, subscriptionId)
+	done(err)
+	return err
+}
@@ -1,14 +1,24 @@
 package payment
 
+import "context"
+
+// Gateways holds the configured payment gateways by the name subscription
+// plans refer to them with.
+type Gateways map[string]PaymentGateway
+
 type PaymentGateway interface {
-	CreateSubscription(itemName string, price int, currency string) (*Subscription, error)
-	CancelSubscription(subscriptionId string) error
-	RetrieveSubscription(subscriptionId string) (*Subscription, error)
+	CreateSubscription(ctx context.Context, itemName string, price int, currency string) (*Subscription, error)
+	CancelSubscription(ctx context.Context, subscriptionId string) error
+	RetrieveSubscription(ctx context.Context, subscriptionId string) (*Subscription, error)
+	// CancelPayment expires the checkout of a subscription that was not paid
+	// and cancels the subscription of one that was.
+	CancelPayment(ctx context.Context, subscriptionId string) error
 }
 
+// Subscription is a subscription as seen by a gateway. Gateways map their
+// own states onto the statuses of model.Subscription.
 type Subscription struct {
-	ID        string `json:"id"`
-	Link      string `json:"link"`
-	Completed bool   `json:"completed"`
-	Canceled  bool   `json:"canceled"`
+	ID     string `json:"id"`
+	Link   string `json:"link"`
+	Status string `json:"status"`
 }
@@ -1,64 +1,102 @@
 package payment
 
 import (
+	"context"
 	"fmt"
+	"sync/atomic"
 
+	"github.com/alterminal/member/model"
 	"github.com/stripe/stripe-go/v81"
-	"github.com/stripe/stripe-go/v81/checkout/session"
-	stripePrice "github.com/stripe/stripe-go/v81/price"
-	"github.com/stripe/stripe-go/v81/subscription"
+	"github.com/stripe/stripe-go/v81/client"
 )
 
 type Stripe struct {
-	Key string `json:"key"`
+	client atomic.Pointer[client.API]
 }
 
-func (s *Stripe) RetrieveSubscription(subscriptionId string) (*Subscription, error) {
-	sess, err := session.Get(subscriptionId, &stripe.CheckoutSessionParams{})
+func NewStripe(key string) *Stripe {
+	s := &Stripe{}
+	s.SetKey(key)
+	return s
+}
+
+// SetKey switches to another API key. Calls in flight finish with the old one.
+func (s *Stripe) SetKey(key string) {
+	api := &client.API{}
+	api.Init(key, nil)
+	s.client.Store(api)
+}
+
+func (s *Stripe) api() *client.API {
+	return s.client.Load()
+}
+
+func (s *Stripe) RetrieveSubscription(ctx context.Context, subscriptionId string) (*Subscription, error) {
+	sess, err := s.api().CheckoutSessions.Get(subscriptionId, &stripe.CheckoutSessionParams{Params: stripe.Params{Context: ctx}})
 	if err != nil {
 		return nil, err
 	}
 	sub := Subscription{
-		ID:        sess.ID,
-		Link:      sess.URL,
-		Completed: sess.PaymentStatus == stripe.CheckoutSessionPaymentStatusPaid,
+		ID:     sess.ID,
+		Link:   sess.URL,
+		Status: model.SubscriptionPending,
+	}
+	if sess.Status == stripe.CheckoutSessionStatusExpired {
+		sub.Status = model.SubscriptionExpired
 	}
-	if !sub.Completed {
+	if sess.Status != stripe.CheckoutSessionStatusComplete || sess.Subscription == nil {
 		return &sub, nil
 	}
-	subResult, err := subscription.Get(sess.Subscription.ID, &stripe.SubscriptionParams{})
+	subResult, err := s.api().Subscriptions.Get(sess.Subscription.ID, &stripe.SubscriptionParams{Params: stripe.Params{Context: ctx}})
 	if err != nil {
-		return &sub, nil
+		return nil, err
+	}
+	status, ok := stripeStatuses[subResult.Status]
+	if !ok {
+		return nil, fmt.Errorf("unknown stripe subscription status %q", subResult.Status)
 	}
-	sub.Canceled = subResult.CanceledAt != 0
+	sub.Status = status
 	return &sub, nil
 }
 
-func (s *Stripe) GetStripeSession(subscriptionId string) (*stripe.CheckoutSession, error) {
-	sess, err := session.Get(subscriptionId, &stripe.CheckoutSessionParams{})
+// stripeStatuses maps the statuses of Stripe subscriptions onto ours.
+var stripeStatuses = map[stripe.SubscriptionStatus]string{
+	stripe.SubscriptionStatusIncomplete:        model.SubscriptionPending,
+	stripe.SubscriptionStatusIncompleteExpired: model.SubscriptionExpired,
+	stripe.SubscriptionStatusTrialing:          model.SubscriptionTrialing,
+	stripe.SubscriptionStatusActive:            model.SubscriptionActive,
+	stripe.SubscriptionStatusPastDue:           model.SubscriptionPastDue,
+	stripe.SubscriptionStatusUnpaid:            model.SubscriptionPastDue,
+	stripe.SubscriptionStatusPaused:            model.SubscriptionPaused,
+	stripe.SubscriptionStatusCanceled:          model.SubscriptionCanceled,
+}
+
+func (s *Stripe) GetStripeSession(ctx context.Context, subscriptionId string) (*stripe.CheckoutSession, error) {
+	sess, err := s.api().CheckoutSessions.Get(subscriptionId, &stripe.CheckoutSessionParams{Params: stripe.Params{Context: ctx}})
 	if err != nil {
 		return nil, err
 	}
 	return sess, nil
 }
 
-func (s *Stripe) GetStripeSubscription(subscriptionId string) (*stripe.Subscription, error) {
-	sess, err := s.GetStripeSession(subscriptionId)
+func (s *Stripe) GetStripeSubscription(ctx context.Context, subscriptionId string) (*stripe.Subscription, error) {
+	sess, err := s.GetStripeSession(ctx, subscriptionId)
 	if err != nil {
 		return nil, err
 	}
 	if sess.Subscription == nil {
 		return nil, fmt.Errorf("subscription not found")
 	}
-	subResult, err := subscription.Get(sess.Subscription.ID, &stripe.SubscriptionParams{})
+	subResult, err := s.api().Subscriptions.Get(sess.Subscription.ID, &stripe.SubscriptionParams{Params: stripe.Params{Context: ctx}})
 	if err != nil {
 		return nil, err
 	}
 	return subResult, nil
 }
 
-func (s *Stripe) CreateSubscription(itemName string, price int, currency string) (*Subscription, error) {
+func (s *Stripe) CreateSubscription(ctx context.Context, itemName string, price int, currency string) (*Subscription, error) {
 	priceParams := &stripe.PriceParams{
+		Params:     stripe.Params{Context: ctx},
 		Currency:   stripe.String(currency),
 		UnitAmount: stripe.Int64(int64(price)),
 		Recurring: &stripe.PriceRecurringParams{
@@ -66,11 +104,12 @@ func (s *Stripe) CreateSubscription(itemName string, price int, currency string)
 		},
 		ProductData: &stripe.PriceProductDataParams{Name: stripe.String(itemName)},
 	}
-	priceEntity, err := stripePrice.New(priceParams)
+	priceEntity, err := s.api().Prices.New(priceParams)
 	if err != nil {
 		return nil, err
 	}
 	params := &stripe.CheckoutSessionParams{
+		Params:     stripe.Params{Context: ctx},
 		SuccessURL: stripe.String("https://www.google.com"),
 		LineItems: []*stripe.CheckoutSessionLineItemParams{
 			{
@@ -80,7 +119,7 @@ func (s *Stripe) CreateSubscription(itemName string, price int, currency string)
 		},
 		Mode: stripe.String(string(stripe.CheckoutSessionModeSubscription)),
 	}
-	result, err := session.New(params)
+	result, err := s.api().CheckoutSessions.New(params)
 	if err != nil {
 		return nil, err
 	}
@@ -91,23 +130,34 @@ func (s *Stripe) CreateSubscription(itemName string, price int, currency string)
 	return &subscription, nil
 }
 
-func (s *Stripe) CancelSubscription(subscriptionId string) error {
-	sub, err := s.GetStripeSubscription(subscriptionId)
+func (s *Stripe) CancelSubscription(ctx context.Context, subscriptionId string) error {
+	sub, err := s.GetStripeSubscription(ctx, subscriptionId)
 	if err != nil {
 		return err
 	}
-	_, err = subscription.Cancel(sub.ID, &stripe.SubscriptionCancelParams{})
+	_, err = s.api().Subscriptions.Cancel(sub.ID, &stripe.SubscriptionCancelParams{Params: stripe.Params{Context: ctx}})
 	return err
 }
 
-func (s *Stripe) CancelPayment(subscriptionId string) error {
-	sess, _ := s.GetStripeSession(subscriptionId)
-	_, err := session.Expire(
-		sess.ID,
-		&stripe.CheckoutSessionExpireParams{},
-	)
+func (s *Stripe) CancelPayment(ctx context.Context, subscriptionId string) error {
+	sess, err := s.GetStripeSession(ctx, subscriptionId)
 	if err != nil {
 		return err
 	}
-	return nil
+	// Stripe expires open sessions on its own after a day at most.
+	if sess.Status == stripe.CheckoutSessionStatusExpired {
+		return nil
+	}
+	if sess.Status == stripe.CheckoutSessionStatusComplete {
+		if sess.Subscription == nil {
+			return nil
+		}
+		_, err = s.api().Subscriptions.Cancel(sess.Subscription.ID, &stripe.SubscriptionCancelParams{Params: stripe.Params{Context: ctx}})
+		return err
+	}
+	_, err = s.api().CheckoutSessions.Expire(
+		sess.ID,
+		&stripe.CheckoutSessionExpireParams{Params: stripe.Params{Context: ctx}},
+	)
+	return err
 }
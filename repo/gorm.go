@@ -0,0 +1,422 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/alterminal/member/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func NewGorm(db *gorm.DB) Repositories {
+	repos := Repositories{
+		Organizations:     &gormOrganizations{db: db},
+		Roles:             &gormRoles{db: db},
+		Spaces:            &gormSpaces{db: db},
+		SubscriptionPlans: &gormSubscriptionPlans{db: db},
+		Subscriptions:     &gormSubscriptions{db: db},
+		AuditLog:          &gormAuditLog{db: db},
+		Webhooks:          &gormWebhooks{db: db},
+		WebhookDeliveries: &gormWebhookDeliveries{db: db},
+		Outbox:            &gormOutbox{db: db},
+		Leases:            &gormLeases{db: db},
+		Jobs:              &gormJobs{db: db},
+	}
+	repos.transaction = func(ctx context.Context, fn func(tx Repositories) error) error {
+		return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return fn(NewGorm(tx))
+		})
+	}
+	return repos
+}
+
+func first[T any](db *gorm.DB, conds ...any) (*T, error) {
+	var t T
+	err := db.First(&t, conds...).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func accountRoleIds(db *gorm.DB, accountId string) *gorm.DB {
+	return db.Model(&model.AccountRole{}).Select("role_id").Where("account_id = ?", accountId)
+}
+
+type gormOrganizations struct {
+	db *gorm.DB
+}
+
+func (r *gormOrganizations) Create(ctx context.Context, organization *model.Organization) error {
+	return r.db.WithContext(ctx).Create(organization).Error
+}
+
+func (r *gormOrganizations) Get(ctx context.Context, id string) (*model.Organization, error) {
+	return first[model.Organization](r.db.WithContext(ctx), "id = ?", id)
+}
+
+func (r *gormOrganizations) Delete(ctx context.Context, id string) error {
+	organization, err := r.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Delete(organization).Error
+}
+
+func (r *gormOrganizations) Save(ctx context.Context, organization *model.Organization) error {
+	return r.db.WithContext(ctx).Save(organization).Error
+}
+
+func (r *gormOrganizations) List(ctx context.Context, limit, page int) (model.Pagination[*model.Organization], error) {
+	return model.ListByOption[model.Organization](r.db.WithContext(ctx), limit, page)
+}
+
+func (r *gormOrganizations) ListByAccount(ctx context.Context, accountId string) ([]model.Organization, error) {
+	var organizations []model.Organization
+	err := r.db.WithContext(ctx).Where("id IN (?)", r.db.Model(&model.Role{}).
+		Select("organization_id").
+		Where("id IN (?)", accountRoleIds(r.db, accountId))).
+		Find(&organizations).Error
+	return organizations, err
+}
+
+type gormRoles struct {
+	db *gorm.DB
+}
+
+func (r *gormRoles) Create(ctx context.Context, role *model.Role) error {
+	return r.db.WithContext(ctx).Create(role).Error
+}
+
+func (r *gormRoles) Get(ctx context.Context, id string) (*model.Role, error) {
+	return first[model.Role](r.db.WithContext(ctx), "id = ?", id)
+}
+
+func (r *gormRoles) Delete(ctx context.Context, id string) error {
+	role, err := r.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Delete(role).Error
+}
+
+func (r *gormRoles) ListByOrganization(ctx context.Context, organizationId string) ([]model.Role, error) {
+	var roles []model.Role
+	err := r.db.WithContext(ctx).Where("organization_id = ?", organizationId).Find(&roles).Error
+	return roles, err
+}
+
+func (r *gormRoles) ListByAccount(ctx context.Context, accountId string) ([]model.Role, error) {
+	var roles []model.Role
+	err := r.db.WithContext(ctx).Where("id IN (?)", accountRoleIds(r.db, accountId)).Find(&roles).Error
+	return roles, err
+}
+
+func (r *gormRoles) AddAccount(ctx context.Context, roleId, accountId string) error {
+	return r.db.WithContext(ctx).Create(&model.AccountRole{AccountID: accountId, RoleID: roleId}).Error
+}
+
+type gormSpaces struct {
+	db *gorm.DB
+}
+
+func (r *gormSpaces) Create(ctx context.Context, space *model.Space) error {
+	return r.db.WithContext(ctx).Create(space).Error
+}
+
+func (r *gormSpaces) Get(ctx context.Context, id string) (*model.Space, error) {
+	return first[model.Space](r.db.WithContext(ctx), "id = ?", id)
+}
+
+func (r *gormSpaces) Delete(ctx context.Context, id string) error {
+	space, err := r.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Delete(space).Error
+}
+
+func (r *gormSpaces) Save(ctx context.Context, space *model.Space) error {
+	return r.db.WithContext(ctx).Save(space).Error
+}
+
+func (r *gormSpaces) ListByOrganization(ctx context.Context, organizationId string) ([]model.Space, error) {
+	var spaces []model.Space
+	err := r.db.WithContext(ctx).Where("organization_id = ?", organizationId).Find(&spaces).Error
+	return spaces, err
+}
+
+func (r *gormSpaces) Children(ctx context.Context, id string) ([]model.Space, error) {
+	var spaces []model.Space
+	err := r.db.WithContext(ctx).Where("parent_id = ?", id).Find(&spaces).Error
+	return spaces, err
+}
+
+type gormSubscriptionPlans struct {
+	db *gorm.DB
+}
+
+func (r *gormSubscriptionPlans) Create(ctx context.Context, plan *model.SubscriptionPlan) error {
+	return r.db.WithContext(ctx).Create(plan).Error
+}
+
+func (r *gormSubscriptionPlans) Get(ctx context.Context, id string) (*model.SubscriptionPlan, error) {
+	return first[model.SubscriptionPlan](r.db.WithContext(ctx), "id = ?", id)
+}
+
+func (r *gormSubscriptionPlans) ListBySpace(ctx context.Context, spaceId string) ([]*model.SubscriptionPlan, error) {
+	var plans []*model.SubscriptionPlan = make([]*model.SubscriptionPlan, 0)
+	err := r.db.WithContext(ctx).Find(&plans, "space_id = ?", spaceId).Error
+	return plans, err
+}
+
+type gormSubscriptions struct {
+	db *gorm.DB
+}
+
+func (r *gormSubscriptions) Create(ctx context.Context, subscription *model.Subscription) error {
+	return r.db.WithContext(ctx).Create(subscription).Error
+}
+
+func (r *gormSubscriptions) Get(ctx context.Context, id string) (*model.Subscription, error) {
+	return first[model.Subscription](r.db.WithContext(ctx), "id = ?", id)
+}
+
+func (r *gormSubscriptions) Save(ctx context.Context, subscription *model.Subscription) error {
+	saved := *subscription
+	saved.Version++
+	result := r.db.WithContext(ctx).Model(&model.Subscription{}).
+		Where("id = ? AND version = ?", subscription.ID, subscription.Version).
+		Select("*").
+		Updates(&saved)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrStale
+	}
+	subscription.Version = saved.Version
+	return nil
+}
+
+func (r *gormSubscriptions) ListActive(ctx context.Context, planId string) ([]*model.Subscription, error) {
+	var subscriptions []*model.Subscription = make([]*model.Subscription, 0)
+	err := r.db.WithContext(ctx).Where("status IN ?", model.LiveSubscriptionStatuses).
+		Where("subscription_plan_id = ?", planId).
+		Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+func (r *gormSubscriptions) FindPending(ctx context.Context, planId string) (*model.Subscription, error) {
+	return first[model.Subscription](r.db.WithContext(ctx).Where("status = ?", model.SubscriptionPending).
+		Where("subscription_plan_id = ?", planId))
+}
+
+func (r *gormSubscriptions) ListPending(ctx context.Context) ([]*model.Subscription, error) {
+	var subscriptions []*model.Subscription
+	err := r.db.WithContext(ctx).Where("status = ?", model.SubscriptionPending).
+		Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+func (r *gormSubscriptions) AddStatusChange(ctx context.Context, change *model.SubscriptionStatusChange) error {
+	return r.db.WithContext(ctx).Create(change).Error
+}
+
+type gormAuditLog struct {
+	db *gorm.DB
+}
+
+func (r *gormAuditLog) Append(ctx context.Context, entry *model.AuditEntry) error {
+	return r.db.WithContext(ctx).Create(entry).Error
+}
+
+func (r *gormAuditLog) Search(ctx context.Context, filter AuditFilter, limit, page int) (model.Pagination[*model.AuditEntry], error) {
+	return model.ListByOption[model.AuditEntry](r.db.WithContext(ctx), limit, page, func(db *gorm.DB) *gorm.DB {
+		for column, value := range map[string]string{
+			"organization_id": filter.OrganizationID,
+			"actor_id":        filter.ActorID,
+			"action":          filter.Action,
+			"target_type":     filter.TargetType,
+			"target_id":       filter.TargetID,
+		} {
+			if value != "" {
+				db = db.Where(column+" = ?", value)
+			}
+		}
+		if !filter.Since.IsZero() {
+			db = db.Where("created_at >= ?", filter.Since)
+		}
+		if !filter.Until.IsZero() {
+			db = db.Where("created_at < ?", filter.Until)
+		}
+		return db.Order("created_at DESC").Order("id DESC")
+	})
+}
+
+type gormWebhooks struct {
+	db *gorm.DB
+}
+
+func (r *gormWebhooks) Create(ctx context.Context, webhook *model.Webhook) error {
+	return r.db.WithContext(ctx).Create(webhook).Error
+}
+
+func (r *gormWebhooks) Get(ctx context.Context, id string) (*model.Webhook, error) {
+	return first[model.Webhook](r.db.WithContext(ctx), "id = ?", id)
+}
+
+func (r *gormWebhooks) Delete(ctx context.Context, id string) error {
+	webhook, err := r.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Delete(webhook).Error
+}
+
+func (r *gormWebhooks) ListByOrganization(ctx context.Context, organizationId string) ([]model.Webhook, error) {
+	var webhooks []model.Webhook
+	err := r.db.WithContext(ctx).Where("organization_id = ?", organizationId).Find(&webhooks).Error
+	return webhooks, err
+}
+
+type gormWebhookDeliveries struct {
+	db *gorm.DB
+}
+
+func (r *gormWebhookDeliveries) Create(ctx context.Context, delivery *model.WebhookDelivery) error {
+	return r.db.WithContext(ctx).Create(delivery).Error
+}
+
+func (r *gormWebhookDeliveries) Get(ctx context.Context, id string) (*model.WebhookDelivery, error) {
+	return first[model.WebhookDelivery](r.db.WithContext(ctx), "id = ?", id)
+}
+
+func (r *gormWebhookDeliveries) Save(ctx context.Context, delivery *model.WebhookDelivery) error {
+	return r.db.WithContext(ctx).Save(delivery).Error
+}
+
+func (r *gormWebhookDeliveries) ListByWebhook(ctx context.Context, webhookId string, limit, page int) (model.Pagination[*model.WebhookDelivery], error) {
+	return model.ListByOption[model.WebhookDelivery](r.db.WithContext(ctx), limit, page, func(db *gorm.DB) *gorm.DB {
+		return db.Where("webhook_id = ?", webhookId).Order("created_at DESC").Order("id DESC")
+	})
+}
+
+func (r *gormWebhookDeliveries) ListDue(ctx context.Context, now time.Time, limit int) ([]*model.WebhookDelivery, error) {
+	var deliveries []*model.WebhookDelivery
+	err := r.db.WithContext(ctx).Where("status = ?", model.DeliveryPending).
+		Where("next_attempt_at <= ?", now).
+		Order("next_attempt_at").
+		Limit(limit).
+		Find(&deliveries).Error
+	return deliveries, err
+}
+
+type gormOutbox struct {
+	db *gorm.DB
+}
+
+func (r *gormOutbox) Add(ctx context.Context, event *model.OutboxEvent) error {
+	return r.db.WithContext(ctx).Create(event).Error
+}
+
+func (r *gormOutbox) ListUnpublished(ctx context.Context, limit int) ([]*model.OutboxEvent, error) {
+	var events []*model.OutboxEvent
+	err := r.db.WithContext(ctx).Where("published_at IS NULL").Order("id").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+func (r *gormOutbox) Save(ctx context.Context, event *model.OutboxEvent) error {
+	return r.db.WithContext(ctx).Save(event).Error
+}
+
+type gormLeases struct {
+	db *gorm.DB
+}
+
+func (r *gormLeases) Acquire(ctx context.Context, name, holder string, expiresAt, now time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&model.Lease{}).
+		Where("name = ?", name).
+		Where("holder = ? OR expires_at < ?", holder, now).
+		Updates(map[string]any{"holder": holder, "expires_at": expiresAt})
+	if result.Error != nil || result.RowsAffected > 0 {
+		return result.RowsAffected > 0, result.Error
+	}
+	result = r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&model.Lease{Name: name, Holder: holder, ExpiresAt: expiresAt})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormLeases) Renew(ctx context.Context, holder string, expiresAt time.Time) ([]string, error) {
+	err := r.db.WithContext(ctx).Model(&model.Lease{}).Where("holder = ?", holder).Update("expires_at", expiresAt).Error
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	err = r.db.WithContext(ctx).Model(&model.Lease{}).Where("holder = ?", holder).Pluck("name", &names).Error
+	return names, err
+}
+
+func (r *gormLeases) Release(ctx context.Context, name, holder string) error {
+	return r.db.WithContext(ctx).Where("name = ? AND holder = ?", name, holder).Delete(&model.Lease{}).Error
+}
+
+type gormJobs struct {
+	db *gorm.DB
+}
+
+func (r *gormJobs) Add(ctx context.Context, job *model.Job) (bool, error) {
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(job)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormJobs) Get(ctx context.Context, id string) (*model.Job, error) {
+	return first[model.Job](r.db.WithContext(ctx), "id = ?", id)
+}
+
+func (r *gormJobs) Save(ctx context.Context, job *model.Job) error {
+	saved := *job
+	saved.Version++
+	result := r.db.WithContext(ctx).Model(&model.Job{}).
+		Where("id = ? AND version = ?", job.ID, job.Version).
+		Select("*").
+		Updates(&saved)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrStale
+	}
+	job.Version = saved.Version
+	return nil
+}
+
+func (r *gormJobs) ListDue(ctx context.Context, now time.Time, limit int) ([]*model.Job, error) {
+	var jobs []*model.Job
+	err := r.db.WithContext(ctx).Where("status = ?", model.JobPending).
+		Where("run_at <= ?", now).
+		Order("run_at").
+		Limit(limit).
+		Find(&jobs).Error
+	return jobs, err
+}
+
+func (r *gormJobs) Search(ctx context.Context, filter JobFilter, limit, page int) (model.Pagination[*model.Job], error) {
+	return model.ListByOption[model.Job](r.db.WithContext(ctx), limit, page, func(db *gorm.DB) *gorm.DB {
+		for column, value := range map[string]string{
+			"type":    filter.Type,
+			"subject": filter.Subject,
+			"status":  filter.Status,
+		} {
+			if value != "" {
+				db = db.Where(column+" = ?", value)
+			}
+		}
+		return db.Order("created_at DESC").Order("id DESC")
+	})
+}
@@ -0,0 +1,204 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alterminal/member/model"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newSqlite(t *testing.T) Repositories {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: opens a database of its own.
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	Init(db)
+	if err := Migrated(db); err != nil {
+		t.Fatal(err)
+	}
+	return NewGorm(db)
+}
+
+func TestGormPagination(t *testing.T) {
+	ctx := context.Background()
+	repos := newSqlite(t)
+	for range 5 {
+		if err := repos.Organizations.Create(ctx, &model.Organization{Name: "organization"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, test := range []struct {
+		name  string
+		limit int
+		page  int
+		items int
+		pages int
+	}{
+		{"first page", 2, 0, 2, 2},
+		{"last page", 2, 2, 1, 2},
+		{"past the end", 2, 3, 0, 2},
+		{"single page", 10, 0, 5, 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			organizations, err := repos.Organizations.List(ctx, test.limit, test.page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(organizations.Items) != test.items {
+				t.Errorf("items = %d, want %d", len(organizations.Items), test.items)
+			}
+			if organizations.Pages != test.pages {
+				t.Errorf("pages = %d, want %d", organizations.Pages, test.pages)
+			}
+			if organizations.Total != 5 || organizations.Limit != test.limit || organizations.Page != test.page {
+				t.Errorf("pagination = %+v", organizations)
+			}
+		})
+	}
+}
+
+func TestGormNotFound(t *testing.T) {
+	ctx := context.Background()
+	repos := newSqlite(t)
+	for _, test := range []struct {
+		name string
+		get  func(id string) error
+	}{
+		{"organization", func(id string) error { _, err := repos.Organizations.Get(ctx, id); return err }},
+		{"organization delete", func(id string) error { return repos.Organizations.Delete(ctx, id) }},
+		{"role", func(id string) error { _, err := repos.Roles.Get(ctx, id); return err }},
+		{"space", func(id string) error { _, err := repos.Spaces.Get(ctx, id); return err }},
+		{"subscription plan", func(id string) error { _, err := repos.SubscriptionPlans.Get(ctx, id); return err }},
+		{"subscription", func(id string) error { _, err := repos.Subscriptions.Get(ctx, id); return err }},
+		{"webhook", func(id string) error { _, err := repos.Webhooks.Get(ctx, id); return err }},
+		{"webhook delivery", func(id string) error { _, err := repos.WebhookDeliveries.Get(ctx, id); return err }},
+		{"job", func(id string) error { _, err := repos.Jobs.Get(ctx, id); return err }},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.get(model.NewID()); !errors.Is(err, ErrNotFound) {
+				t.Errorf("err = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestGormTransaction(t *testing.T) {
+	ctx := context.Background()
+	failed := errors.New("failed")
+	for _, test := range []struct {
+		name      string
+		err       error
+		committed bool
+	}{
+		{"commit", nil, true},
+		{"rollback", failed, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			repos := newSqlite(t)
+			var organization model.Organization
+			err := repos.Transaction(ctx, func(tx Repositories) error {
+				organization = model.Organization{Name: "organization"}
+				if err := tx.Organizations.Create(ctx, &organization); err != nil {
+					return err
+				}
+				if err := tx.Roles.Create(ctx, &model.Role{OrganizationID: organization.ID, Name: "admin"}); err != nil {
+					return err
+				}
+				return test.err
+			})
+			if !errors.Is(err, test.err) {
+				t.Fatalf("err = %v, want %v", err, test.err)
+			}
+			_, err = repos.Organizations.Get(ctx, organization.ID)
+			if committed := err == nil; committed != test.committed {
+				t.Errorf("committed = %t, want %t (err = %v)", committed, test.committed, err)
+			}
+			roles, err := repos.Roles.ListByOrganization(ctx, organization.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if committed := len(roles) == 1; committed != test.committed {
+				t.Errorf("roles = %d, want committed %t", len(roles), test.committed)
+			}
+		})
+	}
+}
+
+func TestInvalidPage(t *testing.T) {
+	ctx := context.Background()
+	for name, repos := range map[string]Repositories{"gorm": newSqlite(t), "memory": NewMemory()} {
+		for _, page := range []struct{ limit, page int }{{0, 0}, {-1, 0}, {10, -1}} {
+			if _, err := repos.Organizations.List(ctx, page.limit, page.page); !errors.Is(err, model.ErrInvalidPage) {
+				t.Errorf("%s: List(%d, %d) err = %v, want ErrInvalidPage", name, page.limit, page.page, err)
+			}
+		}
+	}
+}
+
+func TestJobSaveStale(t *testing.T) {
+	ctx := context.Background()
+	for name, repos := range map[string]Repositories{"gorm": newSqlite(t), "memory": NewMemory()} {
+		job := model.Job{Type: "test", Subject: "subject", Status: model.JobPending}
+		if _, err := repos.Jobs.Add(ctx, &job); err != nil {
+			t.Fatal(err)
+		}
+		first, err := repos.Jobs.Get(ctx, job.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		second := *first
+		first.Status = model.JobSucceeded
+		if err := repos.Jobs.Save(ctx, first); err != nil {
+			t.Fatalf("%s: first save: %v", name, err)
+		}
+		second.Status = model.JobFailed
+		if err := repos.Jobs.Save(ctx, &second); !errors.Is(err, ErrStale) {
+			t.Errorf("%s: second save err = %v, want ErrStale", name, err)
+		}
+		stored, err := repos.Jobs.Get(ctx, job.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Status != model.JobSucceeded || stored.Version != 1 {
+			t.Errorf("%s: stored status %s version %d, want succeeded 1", name, stored.Status, stored.Version)
+		}
+	}
+}
+
+func TestSubscriptionSaveStale(t *testing.T) {
+	ctx := context.Background()
+	for name, repos := range map[string]Repositories{"gorm": newSqlite(t), "memory": NewMemory()} {
+		subscription := model.Subscription{SubscriptionPlanId: model.NewID(), Status: model.SubscriptionActive}
+		if err := repos.Subscriptions.Create(ctx, &subscription); err != nil {
+			t.Fatal(err)
+		}
+		stale := subscription
+		subscription.Status = model.SubscriptionCanceled
+		if err := repos.Subscriptions.Save(ctx, &subscription); err != nil {
+			t.Fatalf("%s: first save: %v", name, err)
+		}
+		stale.Status = model.SubscriptionPastDue
+		if err := repos.Subscriptions.Save(ctx, &stale); !errors.Is(err, ErrStale) {
+			t.Errorf("%s: second save err = %v, want ErrStale", name, err)
+		}
+		stored, err := repos.Subscriptions.Get(ctx, subscription.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Status != model.SubscriptionCanceled {
+			t.Errorf("%s: stored status %s, want canceled", name, stored.Status)
+		}
+	}
+}
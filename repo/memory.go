@@ -0,0 +1,646 @@
+package repo
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alterminal/member/model"
+)
+
+// NewMemory returns repositories backed by process memory, for tests and
+// local development without a database. Its transactions do not roll back.
+func NewMemory() Repositories {
+	store := &memoryStore{
+		organizations: map[string]model.Organization{},
+		roles:         map[string]model.Role{},
+		accountRoles:  map[model.AccountRole]bool{},
+		spaces:        map[string]model.Space{},
+		plans:         map[string]model.SubscriptionPlan{},
+		subscriptions: map[string]model.Subscription{},
+		webhooks:      map[string]model.Webhook{},
+		deliveries:    map[string]model.WebhookDelivery{},
+		outbox:        map[string]model.OutboxEvent{},
+		leases:        map[string]model.Lease{},
+		jobs:          map[string]model.Job{},
+	}
+	repos := Repositories{
+		Organizations:     &memoryOrganizations{store},
+		Roles:             &memoryRoles{store},
+		Spaces:            &memorySpaces{store},
+		SubscriptionPlans: &memorySubscriptionPlans{store},
+		Subscriptions:     &memorySubscriptions{store},
+		AuditLog:          &memoryAuditLog{store},
+		Webhooks:          &memoryWebhooks{store},
+		WebhookDeliveries: &memoryWebhookDeliveries{store},
+		Outbox:            &memoryOutbox{store},
+		Leases:            &memoryLeases{store},
+		Jobs:              &memoryJobs{store},
+	}
+	repos.transaction = func(ctx context.Context, fn func(tx Repositories) error) error {
+		return fn(repos)
+	}
+	return repos
+}
+
+type memoryStore struct {
+	mu            sync.RWMutex
+	organizations map[string]model.Organization
+	roles         map[string]model.Role
+	accountRoles  map[model.AccountRole]bool
+	spaces        map[string]model.Space
+	plans         map[string]model.SubscriptionPlan
+	subscriptions map[string]model.Subscription
+	statusChanges []model.SubscriptionStatusChange
+	audit         []model.AuditEntry
+	webhooks      map[string]model.Webhook
+	deliveries    map[string]model.WebhookDelivery
+	outbox        map[string]model.OutboxEvent
+	leases        map[string]model.Lease
+	jobs          map[string]model.Job
+}
+
+func get[T any](items map[string]T, id string) (*T, error) {
+	t, ok := items[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &t, nil
+}
+
+func filter[T any](items map[string]T, keep func(T) bool) []T {
+	ids := make([]string, 0, len(items))
+	for id := range items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	result := make([]T, 0)
+	for _, id := range ids {
+		if keep(items[id]) {
+			result = append(result, items[id])
+		}
+	}
+	return result
+}
+
+func pointers[T any](items []T) []*T {
+	result := make([]*T, len(items))
+	for i := range items {
+		result[i] = &items[i]
+	}
+	return result
+}
+
+func paginate[T any](all []T, limit, page int) (model.Pagination[*T], error) {
+	if limit < 1 || page < 0 {
+		return model.Pagination[*T]{}, model.ErrInvalidPage
+	}
+	start := len(all)
+	if page <= len(all)/limit {
+		start = page * limit
+	}
+	end := min(start+limit, len(all))
+	return model.Pagination[*T]{
+		Items: pointers(all[start:end]),
+		Page:  page,
+		Pages: len(all) / limit,
+		Limit: limit,
+		Total: len(all),
+	}, nil
+}
+
+func (s *memoryStore) accountRoleIds(accountId string) map[string]bool {
+	ids := map[string]bool{}
+	for accountRole := range s.accountRoles {
+		if accountRole.AccountID == accountId {
+			ids[accountRole.RoleID] = true
+		}
+	}
+	return ids
+}
+
+func (s *memoryStore) deleteRole(id string) {
+	delete(s.roles, id)
+	for accountRole := range s.accountRoles {
+		if accountRole.RoleID == id {
+			delete(s.accountRoles, accountRole)
+		}
+	}
+}
+
+type memoryOrganizations struct {
+	*memoryStore
+}
+
+func (r *memoryOrganizations) Create(ctx context.Context, organization *model.Organization) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	organization.ID = model.NewID()
+	r.organizations[organization.ID] = *organization
+	return nil
+}
+
+func (r *memoryOrganizations) Get(ctx context.Context, id string) (*model.Organization, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return get(r.organizations, id)
+}
+
+func (r *memoryOrganizations) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.organizations[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.organizations, id)
+	for _, role := range r.roles {
+		if role.OrganizationID == id {
+			r.deleteRole(role.ID)
+		}
+	}
+	return nil
+}
+
+func (r *memoryOrganizations) Save(ctx context.Context, organization *model.Organization) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.organizations[organization.ID] = *organization
+	return nil
+}
+
+func (r *memoryOrganizations) List(ctx context.Context, limit, page int) (model.Pagination[*model.Organization], error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	all := filter(r.organizations, func(model.Organization) bool { return true })
+	return paginate(all, limit, page)
+}
+
+func (r *memoryOrganizations) ListByAccount(ctx context.Context, accountId string) ([]model.Organization, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	organizationIds := map[string]bool{}
+	for roleId := range r.accountRoleIds(accountId) {
+		if role, ok := r.roles[roleId]; ok {
+			organizationIds[role.OrganizationID] = true
+		}
+	}
+	return filter(r.organizations, func(organization model.Organization) bool {
+		return organizationIds[organization.ID]
+	}), nil
+}
+
+type memoryRoles struct {
+	*memoryStore
+}
+
+func (r *memoryRoles) Create(ctx context.Context, role *model.Role) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	role.ID = model.NewID()
+	r.roles[role.ID] = *role
+	return nil
+}
+
+func (r *memoryRoles) Get(ctx context.Context, id string) (*model.Role, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return get(r.roles, id)
+}
+
+func (r *memoryRoles) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.roles[id]; !ok {
+		return ErrNotFound
+	}
+	r.deleteRole(id)
+	return nil
+}
+
+func (r *memoryRoles) ListByOrganization(ctx context.Context, organizationId string) ([]model.Role, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return filter(r.roles, func(role model.Role) bool {
+		return role.OrganizationID == organizationId
+	}), nil
+}
+
+func (r *memoryRoles) ListByAccount(ctx context.Context, accountId string) ([]model.Role, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	roleIds := r.accountRoleIds(accountId)
+	return filter(r.roles, func(role model.Role) bool {
+		return roleIds[role.ID]
+	}), nil
+}
+
+func (r *memoryRoles) AddAccount(ctx context.Context, roleId, accountId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.accountRoles[model.AccountRole{AccountID: accountId, RoleID: roleId}] = true
+	return nil
+}
+
+type memorySpaces struct {
+	*memoryStore
+}
+
+func (r *memorySpaces) Create(ctx context.Context, space *model.Space) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if space.ParentId != nil {
+		parent, ok := r.spaces[*space.ParentId]
+		if !ok || parent.OrganizationID != space.OrganizationID {
+			space.ParentId = nil
+		}
+	}
+	space.ID = model.NewID()
+	r.spaces[space.ID] = *space
+	return nil
+}
+
+func (r *memorySpaces) Get(ctx context.Context, id string) (*model.Space, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return get(r.spaces, id)
+}
+
+func (r *memorySpaces) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.spaces[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.spaces, id)
+	return nil
+}
+
+func (r *memorySpaces) Save(ctx context.Context, space *model.Space) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spaces[space.ID] = *space
+	return nil
+}
+
+func (r *memorySpaces) ListByOrganization(ctx context.Context, organizationId string) ([]model.Space, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return filter(r.spaces, func(space model.Space) bool {
+		return space.OrganizationID == organizationId
+	}), nil
+}
+
+func (r *memorySpaces) Children(ctx context.Context, id string) ([]model.Space, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return filter(r.spaces, func(space model.Space) bool {
+		return space.ParentId != nil && *space.ParentId == id
+	}), nil
+}
+
+type memorySubscriptionPlans struct {
+	*memoryStore
+}
+
+func (r *memorySubscriptionPlans) Create(ctx context.Context, plan *model.SubscriptionPlan) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	plan.ID = model.NewID()
+	r.plans[plan.ID] = *plan
+	return nil
+}
+
+func (r *memorySubscriptionPlans) Get(ctx context.Context, id string) (*model.SubscriptionPlan, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return get(r.plans, id)
+}
+
+func (r *memorySubscriptionPlans) ListBySpace(ctx context.Context, spaceId string) ([]*model.SubscriptionPlan, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return pointers(filter(r.plans, func(plan model.SubscriptionPlan) bool {
+		return plan.SpaceID == spaceId
+	})), nil
+}
+
+type memorySubscriptions struct {
+	*memoryStore
+}
+
+func (r *memorySubscriptions) Create(ctx context.Context, subscription *model.Subscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	subscription.ID = model.NewID()
+	subscription.CreatedAt = time.Now()
+	r.subscriptions[subscription.ID] = *subscription
+	return nil
+}
+
+func (r *memorySubscriptions) Get(ctx context.Context, id string) (*model.Subscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return get(r.subscriptions, id)
+}
+
+func (r *memorySubscriptions) Save(ctx context.Context, subscription *model.Subscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stored, ok := r.subscriptions[subscription.ID]; !ok || stored.Version != subscription.Version {
+		return ErrStale
+	}
+	subscription.Version++
+	r.subscriptions[subscription.ID] = *subscription
+	return nil
+}
+
+func (r *memorySubscriptions) ListActive(ctx context.Context, planId string) ([]*model.Subscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return pointers(filter(r.subscriptions, func(subscription model.Subscription) bool {
+		return subscription.SubscriptionPlanId == planId &&
+			slices.Contains(model.LiveSubscriptionStatuses, subscription.Status)
+	})), nil
+}
+
+func (r *memorySubscriptions) FindPending(ctx context.Context, planId string) (*model.Subscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	pending := filter(r.subscriptions, func(subscription model.Subscription) bool {
+		return subscription.SubscriptionPlanId == planId && isPending(subscription)
+	})
+	if len(pending) == 0 {
+		return nil, ErrNotFound
+	}
+	return &pending[0], nil
+}
+
+func (r *memorySubscriptions) ListPending(ctx context.Context) ([]*model.Subscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return pointers(filter(r.subscriptions, isPending)), nil
+}
+
+func isPending(subscription model.Subscription) bool {
+	return subscription.Status == model.SubscriptionPending
+}
+
+func (r *memorySubscriptions) AddStatusChange(ctx context.Context, change *model.SubscriptionStatusChange) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	change.ID = model.NewID()
+	change.CreatedAt = time.Now()
+	r.statusChanges = append(r.statusChanges, *change)
+	return nil
+}
+
+type memoryAuditLog struct {
+	*memoryStore
+}
+
+func (r *memoryAuditLog) Append(ctx context.Context, entry *model.AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry.ID = model.NewID()
+	entry.CreatedAt = time.Now()
+	r.audit = append(r.audit, *entry)
+	return nil
+}
+
+func (f AuditFilter) match(entry model.AuditEntry) bool {
+	return (f.OrganizationID == "" || entry.OrganizationID == f.OrganizationID) &&
+		(f.ActorID == "" || entry.ActorID == f.ActorID) &&
+		(f.Action == "" || entry.Action == f.Action) &&
+		(f.TargetType == "" || entry.TargetType == f.TargetType) &&
+		(f.TargetID == "" || entry.TargetID == f.TargetID) &&
+		(f.Since.IsZero() || !entry.CreatedAt.Before(f.Since)) &&
+		(f.Until.IsZero() || entry.CreatedAt.Before(f.Until))
+}
+
+func (r *memoryAuditLog) Search(ctx context.Context, filter AuditFilter, limit, page int) (model.Pagination[*model.AuditEntry], error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var all []model.AuditEntry
+	for i := len(r.audit) - 1; i >= 0; i-- {
+		if filter.match(r.audit[i]) {
+			all = append(all, r.audit[i])
+		}
+	}
+	return paginate(all, limit, page)
+}
+
+type memoryWebhooks struct {
+	*memoryStore
+}
+
+func (r *memoryWebhooks) Create(ctx context.Context, webhook *model.Webhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	webhook.ID = model.NewID()
+	webhook.CreatedAt = time.Now()
+	r.webhooks[webhook.ID] = *webhook
+	return nil
+}
+
+func (r *memoryWebhooks) Get(ctx context.Context, id string) (*model.Webhook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return get(r.webhooks, id)
+}
+
+func (r *memoryWebhooks) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.webhooks[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.webhooks, id)
+	for deliveryId, delivery := range r.deliveries {
+		if delivery.WebhookID == id {
+			delete(r.deliveries, deliveryId)
+		}
+	}
+	return nil
+}
+
+func (r *memoryWebhooks) ListByOrganization(ctx context.Context, organizationId string) ([]model.Webhook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return filter(r.webhooks, func(webhook model.Webhook) bool {
+		return webhook.OrganizationID == organizationId
+	}), nil
+}
+
+type memoryWebhookDeliveries struct {
+	*memoryStore
+}
+
+func (r *memoryWebhookDeliveries) Create(ctx context.Context, delivery *model.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delivery.ID = model.NewID()
+	delivery.CreatedAt = time.Now()
+	r.deliveries[delivery.ID] = *delivery
+	return nil
+}
+
+func (r *memoryWebhookDeliveries) Get(ctx context.Context, id string) (*model.WebhookDelivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return get(r.deliveries, id)
+}
+
+func (r *memoryWebhookDeliveries) Save(ctx context.Context, delivery *model.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deliveries[delivery.ID] = *delivery
+	return nil
+}
+
+func (r *memoryWebhookDeliveries) ListByWebhook(ctx context.Context, webhookId string, limit, page int) (model.Pagination[*model.WebhookDelivery], error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	all := filter(r.deliveries, func(delivery model.WebhookDelivery) bool {
+		return delivery.WebhookID == webhookId
+	})
+	// Snowflake ids sort by creation time.
+	slices.Reverse(all)
+	return paginate(all, limit, page)
+}
+
+func (r *memoryWebhookDeliveries) ListDue(ctx context.Context, now time.Time, limit int) ([]*model.WebhookDelivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	due := filter(r.deliveries, func(delivery model.WebhookDelivery) bool {
+		return delivery.Status == model.DeliveryPending && delivery.NextAttemptAt != nil && !delivery.NextAttemptAt.After(now)
+	})
+	return pointers(due[:min(limit, len(due))]), nil
+}
+
+type memoryOutbox struct {
+	*memoryStore
+}
+
+func (r *memoryOutbox) Add(ctx context.Context, event *model.OutboxEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	event.ID = model.NewID()
+	event.CreatedAt = time.Now()
+	r.outbox[event.ID] = *event
+	return nil
+}
+
+func (r *memoryOutbox) ListUnpublished(ctx context.Context, limit int) ([]*model.OutboxEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	unpublished := filter(r.outbox, func(event model.OutboxEvent) bool {
+		return event.PublishedAt == nil
+	})
+	return pointers(unpublished[:min(limit, len(unpublished))]), nil
+}
+
+func (r *memoryOutbox) Save(ctx context.Context, event *model.OutboxEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.outbox[event.ID] = *event
+	return nil
+}
+
+type memoryLeases struct {
+	*memoryStore
+}
+
+func (r *memoryLeases) Acquire(ctx context.Context, name, holder string, expiresAt, now time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	lease, ok := r.leases[name]
+	if ok && lease.Holder != holder && !lease.ExpiresAt.Before(now) {
+		return false, nil
+	}
+	r.leases[name] = model.Lease{Name: name, Holder: holder, ExpiresAt: expiresAt}
+	return true, nil
+}
+
+func (r *memoryLeases) Renew(ctx context.Context, holder string, expiresAt time.Time) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := []string{}
+	for name, lease := range r.leases {
+		if lease.Holder == holder {
+			lease.ExpiresAt = expiresAt
+			r.leases[name] = lease
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (r *memoryLeases) Release(ctx context.Context, name, holder string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if lease, ok := r.leases[name]; ok && lease.Holder == holder {
+		delete(r.leases, name)
+	}
+	return nil
+}
+
+type memoryJobs struct {
+	*memoryStore
+}
+
+func (r *memoryJobs) Add(ctx context.Context, job *model.Job) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, other := range r.jobs {
+		if other.Type == job.Type && other.Subject == job.Subject {
+			return false, nil
+		}
+	}
+	job.ID = model.NewID()
+	job.CreatedAt = time.Now()
+	r.jobs[job.ID] = *job
+	return true, nil
+}
+
+func (r *memoryJobs) Get(ctx context.Context, id string) (*model.Job, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return get(r.jobs, id)
+}
+
+func (r *memoryJobs) Save(ctx context.Context, job *model.Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stored, ok := r.jobs[job.ID]; !ok || stored.Version != job.Version {
+		return ErrStale
+	}
+	job.Version++
+	r.jobs[job.ID] = *job
+	return nil
+}
+
+func (r *memoryJobs) ListDue(ctx context.Context, now time.Time, limit int) ([]*model.Job, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	due := filter(r.jobs, func(job model.Job) bool {
+		return job.Status == model.JobPending && job.RunAt != nil && !job.RunAt.After(now)
+	})
+	slices.SortStableFunc(due, func(a, b model.Job) int {
+		return a.RunAt.Compare(*b.RunAt)
+	})
+	return pointers(due[:min(limit, len(due))]), nil
+}
+
+func (r *memoryJobs) Search(ctx context.Context, jobFilter JobFilter, limit, page int) (model.Pagination[*model.Job], error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	all := filter(r.jobs, func(job model.Job) bool {
+		return (jobFilter.Type == "" || job.Type == jobFilter.Type) &&
+			(jobFilter.Subject == "" || job.Subject == jobFilter.Subject) &&
+			(jobFilter.Status == "" || job.Status == jobFilter.Status)
+	})
+	slices.Reverse(all)
+	return paginate(all, limit, page)
+}
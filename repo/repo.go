@@ -1,37 +1,212 @@
 package repo
 
 import (
-	authModel "github.com/alterminal/auth/model"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/alterminal/member/model"
 	"gorm.io/gorm"
 )
 
+var ErrNotFound = errors.New("record not found")
+
+// ErrStale is returned when saving a record that changed since it was read.
+var ErrStale = errors.New("record changed since it was read")
+
+type Organizations interface {
+	Create(ctx context.Context, organization *model.Organization) error
+	Get(ctx context.Context, id string) (*model.Organization, error)
+	Delete(ctx context.Context, id string) error
+	Save(ctx context.Context, organization *model.Organization) error
+	List(ctx context.Context, limit, page int) (model.Pagination[*model.Organization], error)
+	ListByAccount(ctx context.Context, accountId string) ([]model.Organization, error)
+}
+
+type Roles interface {
+	Create(ctx context.Context, role *model.Role) error
+	Get(ctx context.Context, id string) (*model.Role, error)
+	Delete(ctx context.Context, id string) error
+	ListByOrganization(ctx context.Context, organizationId string) ([]model.Role, error)
+	ListByAccount(ctx context.Context, accountId string) ([]model.Role, error)
+	AddAccount(ctx context.Context, roleId, accountId string) error
+}
+
+type Spaces interface {
+	Create(ctx context.Context, space *model.Space) error
+	Get(ctx context.Context, id string) (*model.Space, error)
+	Delete(ctx context.Context, id string) error
+	Save(ctx context.Context, space *model.Space) error
+	ListByOrganization(ctx context.Context, organizationId string) ([]model.Space, error)
+	Children(ctx context.Context, id string) ([]model.Space, error)
+}
+
+type SubscriptionPlans interface {
+	Create(ctx context.Context, plan *model.SubscriptionPlan) error
+	Get(ctx context.Context, id string) (*model.SubscriptionPlan, error)
+	ListBySpace(ctx context.Context, spaceId string) ([]*model.SubscriptionPlan, error)
+}
+
+type Subscriptions interface {
+	Create(ctx context.Context, subscription *model.Subscription) error
+	Get(ctx context.Context, id string) (*model.Subscription, error)
+	// Save stores subscription and bumps its version, unless the stored
+	// subscription has another version, when it returns ErrStale.
+	Save(ctx context.Context, subscription *model.Subscription) error
+	// ListActive returns the live subscriptions of a plan.
+	ListActive(ctx context.Context, planId string) ([]*model.Subscription, error)
+	// FindPending returns a subscription of a plan whose checkout is still open.
+	FindPending(ctx context.Context, planId string) (*model.Subscription, error)
+	ListPending(ctx context.Context) ([]*model.Subscription, error)
+	AddStatusChange(ctx context.Context, change *model.SubscriptionStatusChange) error
+}
+
+type Webhooks interface {
+	Create(ctx context.Context, webhook *model.Webhook) error
+	Get(ctx context.Context, id string) (*model.Webhook, error)
+	// Delete removes the webhook and its deliveries.
+	Delete(ctx context.Context, id string) error
+	ListByOrganization(ctx context.Context, organizationId string) ([]model.Webhook, error)
+}
+
+type WebhookDeliveries interface {
+	Create(ctx context.Context, delivery *model.WebhookDelivery) error
+	Get(ctx context.Context, id string) (*model.WebhookDelivery, error)
+	Save(ctx context.Context, delivery *model.WebhookDelivery) error
+	// ListByWebhook returns the deliveries of a webhook, newest first.
+	ListByWebhook(ctx context.Context, webhookId string, limit, page int) (model.Pagination[*model.WebhookDelivery], error)
+	// ListDue returns pending deliveries whose next attempt is not after now.
+	ListDue(ctx context.Context, now time.Time, limit int) ([]*model.WebhookDelivery, error)
+}
+
+type Outbox interface {
+	Add(ctx context.Context, event *model.OutboxEvent) error
+	// ListUnpublished returns the oldest events not published yet.
+	ListUnpublished(ctx context.Context, limit int) ([]*model.OutboxEvent, error)
+	Save(ctx context.Context, event *model.OutboxEvent) error
+}
+
+type Leases interface {
+	// Acquire takes or renews the lease name for holder, unless another
+	// holder's lease is still valid at now.
+	Acquire(ctx context.Context, name, holder string, expiresAt, now time.Time) (bool, error)
+	// Renew extends every lease of holder and returns the names it holds.
+	Renew(ctx context.Context, holder string, expiresAt time.Time) ([]string, error)
+	Release(ctx context.Context, name, holder string) error
+}
+
+// AuditFilter narrows an audit search. Empty fields match everything.
+type AuditFilter struct {
+	OrganizationID string
+	ActorID        string
+	Action         string
+	TargetType     string
+	TargetID       string
+	Since          time.Time
+	Until          time.Time
+}
+
+type JobFilter struct {
+	Type    string
+	Subject string
+	Status  string
+}
+
+type Jobs interface {
+	// Add creates job unless its type already has a job for its subject, and
+	// reports whether it did.
+	Add(ctx context.Context, job *model.Job) (bool, error)
+	Get(ctx context.Context, id string) (*model.Job, error)
+	// Save stores job and bumps its version, unless the stored job has
+	// another version, when it returns ErrStale.
+	Save(ctx context.Context, job *model.Job) error
+	// ListDue returns pending jobs whose run is not after now, the earliest
+	// first.
+	ListDue(ctx context.Context, now time.Time, limit int) ([]*model.Job, error)
+	// Search returns the jobs matching filter, newest first.
+	Search(ctx context.Context, filter JobFilter, limit, page int) (model.Pagination[*model.Job], error)
+}
+
+// AuditLog is append only.
+type AuditLog interface {
+	Append(ctx context.Context, entry *model.AuditEntry) error
+	// Search returns the matching entries, newest first.
+	Search(ctx context.Context, filter AuditFilter, limit, page int) (model.Pagination[*model.AuditEntry], error)
+}
+
+type Repositories struct {
+	Organizations     Organizations
+	Roles             Roles
+	Spaces            Spaces
+	SubscriptionPlans SubscriptionPlans
+	Subscriptions     Subscriptions
+	AuditLog          AuditLog
+	Webhooks          Webhooks
+	WebhookDeliveries WebhookDeliveries
+	Outbox            Outbox
+	Leases            Leases
+	Jobs              Jobs
+
+	transaction func(ctx context.Context, fn func(tx Repositories) error) error
+}
+
+// Transaction calls fn with repositories whose writes are committed together
+// when fn returns nil and rolled back otherwise.
+func (r Repositories) Transaction(ctx context.Context, fn func(tx Repositories) error) error {
+	return r.transaction(ctx, fn)
+}
+
+var models = []any{
+	&model.Organization{},
+	&model.Role{},
+	&model.AccountRole{},
+	&model.Space{},
+	&model.SubscriptionPlan{},
+	&model.Subscription{},
+	&model.SubscriptionStatusChange{},
+	&model.AuditEntry{},
+	&model.Webhook{},
+	&model.WebhookDelivery{},
+	&model.OutboxEvent{},
+	&model.Lease{},
+	&model.Job{},
+}
+
 func Init(db *gorm.DB) {
-	db.AutoMigrate(&model.Organization{})
-	db.AutoMigrate(&model.Role{})
-	db.AutoMigrate(&model.AccountRole{})
-	db.AutoMigrate(&model.Space{})
-	db.AutoMigrate(&model.SubscriptionPlan{})
-	db.AutoMigrate(&model.Subscription{})
-	var subscriptions []model.Subscription
-	db.Where("completed_at IS NULL").
-		Where("canceled_at IS NULL").
-		Find(&subscriptions)
-	for _, subscription := range subscriptions {
-		go subscription.Watch(db)
+	for _, m := range models {
+		db.AutoMigrate(m)
 	}
+	backfillSubscriptionStatus(db)
 }
 
-func AccountRoles(db *gorm.DB, account authModel.Account) []model.Role {
-	var roles []model.Role
-	db.Raw(`SELECT * FROM roles WHERE id IN (SELECT role_id FROM account_roles WHERE account_id = ?)`, account.ID).Scan(&roles)
-	return roles
+// backfillSubscriptionStatus gives subscriptions created before they had a
+// status the one their timestamps imply.
+func backfillSubscriptionStatus(db *gorm.DB) {
+	for _, backfill := range []struct {
+		status    string
+		condition string
+	}{
+		{model.SubscriptionExpired, "expired_at IS NOT NULL"},
+		{model.SubscriptionCanceled, "canceled_at IS NOT NULL"},
+		{model.SubscriptionActive, "completed_at IS NOT NULL"},
+		{model.SubscriptionPending, "1 = 1"},
+	} {
+		db.Model(&model.Subscription{}).
+			Where("status = '' OR status IS NULL").
+			Where(backfill.condition).
+			Update("status", backfill.status)
+	}
 }
 
-func AccountOrganizations(db *gorm.DB, account authModel.Account) []model.Organization {
-	var organizations []model.Organization
-	db.Raw(`SELECT * FROM organizations 
-		WHERE id IN (SELECT organization_id FROM roles WHERE id IN (SELECT role_id FROM account_roles WHERE account_id = ?))
-		`, account.ID).Scan(&organizations)
-	return organizations
+// Migrated reports an error when a table created by Init is missing.
+func Migrated(db *gorm.DB) error {
+	for _, m := range models {
+		if !db.Migrator().HasTable(m) {
+			statement := &gorm.Statement{DB: db}
+			statement.Parse(m)
+			return fmt.Errorf("table %s is missing", statement.Table)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,60 @@
+// Package types holds the request and response bodies of the member API. It
+// only depends on the standard library so that clients can use it without
+// pulling in the server.
+package types
+
+type CreateTenantRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+type SetPasswordRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name" binding:"required,max=255"`
+}
+
+type SetAllowedOriginsRequest struct {
+	Origins []string `json:"origins" binding:"dive,origin"`
+}
+
+type CreateRoleRequest struct {
+	Name string `json:"name" binding:"required,max=255"`
+}
+
+type SetAccountRoleRequest struct {
+	AccountId string `json:"accountId" binding:"required"`
+}
+
+type CreateSpaceRequest struct {
+	Name     string  `json:"name" binding:"required,max=255"`
+	ParentId *string `json:"parentId" binding:"omitempty,numeric"`
+}
+
+type UpdateSpaceRequest struct {
+	Name string `json:"name" binding:"required,max=255"`
+}
+
+type CreateConsumerRequest struct {
+	PhoneRegion string `json:"phoneRegion" binding:"required,numeric,max=3"`
+	PhoneNumber string `json:"phoneNumber" binding:"required,numeric"`
+	Password    string `json:"password" binding:"required"`
+}
+
+type CreateSubscriptionPlanRequest struct {
+	PaymentGateway string `json:"paymentGateway" binding:"required,oneof=stripe"`
+	PlanName       string `json:"planName" binding:"required,max=255"`
+	Currency       string `json:"currency" binding:"required,currency"`
+	Price          int    `json:"price" binding:"gte=0"`
+}
+
+type CancelSubscriptionRequest struct {
+	Secret string `json:"secret" binding:"required"`
+}
+
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" binding:"required,max=2048,https"`
+	Events []string `json:"events" binding:"required,min=1,dive,event"`
+}
@@ -0,0 +1,121 @@
+package types
+
+import "time"
+
+type Pagination[T any] struct {
+	Items []T `json:"items"`
+	Page  int `json:"page"`
+	Pages int `json:"pages"`
+	Limit int `json:"limit"`
+	Total int `json:"total"`
+}
+
+// Account is an account of the auth service.
+type Account struct {
+	ID          string `json:"id"`
+	Namespace   string `json:"namespace"`
+	Email       string `json:"email"`
+	PhoneRegion string `json:"phoneRegion"`
+	PhoneNumber string `json:"phoneNumber"`
+}
+
+type Organization struct {
+	ID             string   `json:"id"`
+	Name           string   `json:"name"`
+	AllowedOrigins []string `json:"allowedOrigins"`
+}
+
+type Role struct {
+	ID             string `json:"id"`
+	OrganizationID string `json:"organizationId"`
+	Name           string `json:"name"`
+}
+
+type Space struct {
+	ID             string     `json:"id"`
+	OrganizationID string     `json:"organizationId"`
+	ParentId       *string    `json:"parentId"`
+	Name           string     `json:"name"`
+	DisabledAt     *time.Time `json:"disabledAt"`
+}
+
+type SubscriptionPlan struct {
+	ID             string `json:"id"`
+	PlanName       string `json:"planName"`
+	SpaceID        string `json:"spaceId"`
+	Currency       string `json:"currency"`
+	Price          int    `json:"price"`
+	PaymentGateway string `json:"paymentGateway"`
+}
+
+// Entitlement is a plan of a space with a live subscription.
+type Entitlement struct {
+	SubscriptionPlanID string `json:"subscriptionPlanId"`
+	PlanName           string `json:"planName"`
+	SubscriptionID     string `json:"subscriptionId"`
+	Status             string `json:"status"`
+}
+
+type Checkout struct {
+	// ID is the id of the subscription the checkout is for.
+	ID          string `json:"id"`
+	PaymentLink string `json:"paymentLink"`
+	// Secret cancels the subscription once completed.
+	Secret string `json:"secret"`
+}
+
+type Webhook struct {
+	ID             string    `json:"id"`
+	OrganizationID string    `json:"organizationId"`
+	URL            string    `json:"url"`
+	Events         []string  `json:"events"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// CreatedWebhook is the only response carrying the secret of a webhook.
+type CreatedWebhook struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+type WebhookDelivery struct {
+	ID             string     `json:"id"`
+	WebhookID      string     `json:"webhookId"`
+	EventID        string     `json:"eventId"`
+	Event          string     `json:"event"`
+	Payload        string     `json:"payload"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	ResponseStatus int        `json:"responseStatus"`
+	Error          string     `json:"error"`
+	NextAttemptAt  *time.Time `json:"nextAttemptAt"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	DeliveredAt    *time.Time `json:"deliveredAt"`
+}
+
+type Job struct {
+	ID         string     `json:"id"`
+	Type       string     `json:"type"`
+	Subject    string     `json:"subject"`
+	Payload    string     `json:"payload"`
+	Status     string     `json:"status"`
+	Attempts   int        `json:"attempts"`
+	Error      string     `json:"error"`
+	RunAt      *time.Time `json:"runAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	FinishedAt *time.Time `json:"finishedAt"`
+}
+
+type AuditEntry struct {
+	ID             string         `json:"id"`
+	CreatedAt      time.Time      `json:"createdAt"`
+	ActorID        string         `json:"actorId"`
+	OrganizationID string         `json:"organizationId"`
+	Action         string         `json:"action"`
+	TargetType     string         `json:"targetType"`
+	TargetID       string         `json:"targetId"`
+	Before         map[string]any `json:"before"`
+	After          map[string]any `json:"after"`
+	IP             string         `json:"ip"`
+	RequestID      string         `json:"requestId"`
+}
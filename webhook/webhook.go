@@ -0,0 +1,323 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alterminal/member/events"
+	"github.com/alterminal/member/lease"
+	"github.com/alterminal/member/metrics"
+	"github.com/alterminal/member/model"
+	"github.com/alterminal/member/repo"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Events lists the events webhooks can subscribe to.
+var Events = []string{
+	model.EventSubscriptionCreated,
+	model.EventSubscriptionCompleted,
+	model.EventSubscriptionCanceled,
+	model.EventSubscriptionExpired,
+	model.EventSubscriptionStatusChanged,
+	model.EventConsumerCreated,
+	model.EventSpaceUpdated,
+}
+
+const (
+	SignatureHeader = "X-Member-Signature"
+	EventHeader     = "X-Member-Event"
+	DeliveryHeader  = "X-Member-Delivery"
+)
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// concurrency bounds the deliveries sent at once.
+const concurrency = 8
+
+// maxBackoff caps the delay between attempts of a delivery.
+const maxBackoff = time.Hour
+
+// backoff returns the delay before retrying a delivery that failed attempts
+// times: base, doubled for every failed attempt after the first, up to
+// maxBackoff.
+func backoff(base time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackoff)
+}
+
+type Config struct {
+	Timeout     time.Duration
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled for every later
+	// one up to an hour.
+	Backoff      time.Duration
+	PollInterval time.Duration
+}
+
+// Dispatcher queues events for the webhooks subscribed to them and delivers
+// them, as JSON encoded events.Event, in the background, retrying failed deliveries with exponential
+// backoff. Only the replica holding the dispatcher lease delivers.
+type Dispatcher struct {
+	ctx        context.Context
+	config     Config
+	leases     *lease.Manager
+	logger     *slog.Logger
+	webhooks   repo.Webhooks
+	deliveries repo.WebhookDeliveries
+	client     *http.Client
+	wake       chan struct{}
+	done       sync.WaitGroup
+}
+
+// New returns a Dispatcher whose deliveries stop once ctx is done.
+func New(ctx context.Context, repos repo.Repositories, config Config, leases *lease.Manager, logger *slog.Logger) *Dispatcher {
+	return &Dispatcher{
+		ctx:        ctx,
+		config:     config,
+		leases:     leases,
+		logger:     logger,
+		webhooks:   repos.Webhooks,
+		deliveries: repos.WebhookDeliveries,
+		client:     &http.Client{Transport: otelhttp.NewTransport(transport())},
+		wake:       make(chan struct{}, 1),
+	}
+}
+
+// NewSecret returns a random secret to sign the payloads of a webhook.
+func NewSecret() string {
+	secret := make([]byte, 24)
+	rand.Read(secret)
+	return "whsec_" + hex.EncodeToString(secret)
+}
+
+// Sign returns the signature header of payload sent at timestamp:
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<payload>" keyed by secret>".
+func Sign(secret string, timestamp time.Time, payload []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + t + ",v1=" + signature(secret, t, payload)
+}
+
+func signature(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature header of a received payload, rejecting ones
+// signed more than tolerance ago.
+func Verify(secret, header string, payload []byte, tolerance time.Duration) error {
+	var timestamp, signed string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signed = value
+		}
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.Unix(unix, 0)) > tolerance {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signed), []byte(signature(secret, timestamp, payload))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Handle queues event for every webhook of its organization subscribed to
+// it. It subscribes the Dispatcher to an event bus.
+func (d *Dispatcher) Handle(ctx context.Context, event events.Event) error {
+	if !slices.Contains(Events, event.Type) {
+		return nil
+	}
+	webhooks, err := d.webhooks.ListByOrganization(ctx, event.OrganizationID)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	queued := false
+	for _, webhook := range webhooks {
+		if !slices.Contains(webhook.Events, event.Type) {
+			continue
+		}
+		delivery := model.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			EventID:       event.ID,
+			Event:         event.Type,
+			Payload:       string(payload),
+			Status:        model.DeliveryPending,
+			NextAttemptAt: model.FNow(),
+		}
+		if err := d.deliveries.Create(ctx, &delivery); err != nil {
+			return err
+		}
+		queued = true
+	}
+	if queued {
+		d.notify()
+	}
+	return nil
+}
+
+// Redeliver queues the event of delivery again as a new delivery.
+func (d *Dispatcher) Redeliver(ctx context.Context, delivery *model.WebhookDelivery) (*model.WebhookDelivery, error) {
+	redelivery := model.WebhookDelivery{
+		WebhookID:     delivery.WebhookID,
+		EventID:       delivery.EventID,
+		Event:         delivery.Event,
+		Payload:       delivery.Payload,
+		Status:        model.DeliveryPending,
+		NextAttemptAt: model.FNow(),
+	}
+	if err := d.deliveries.Create(ctx, &redelivery); err != nil {
+		return nil, err
+	}
+	d.notify()
+	return &redelivery, nil
+}
+
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start delivers queued events until the context of d is done.
+func (d *Dispatcher) Start() {
+	d.done.Add(1)
+	go func() {
+		defer d.done.Done()
+		for {
+			d.deliverDue()
+			select {
+			case <-d.ctx.Done():
+				return
+			case <-d.wake:
+			case <-time.After(d.config.PollInterval):
+			}
+		}
+	}()
+}
+
+// Wait blocks until the deliveries in flight are finished.
+func (d *Dispatcher) Wait() {
+	d.done.Wait()
+}
+
+// deliverDue delivers a batch under the context of the lease, stopping once
+// the lease is lost so a replica that took it over does not deliver alongside.
+func (d *Dispatcher) deliverDue() {
+	ctx, ok := d.leases.Acquire("webhook-dispatcher")
+	if !ok {
+		return
+	}
+	deliveries, err := d.deliveries.ListDue(ctx, time.Now(), 100)
+	if err != nil {
+		d.logger.Error("listing due webhook deliveries failed", "error", err)
+		return
+	}
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, concurrency)
+	for _, delivery := range deliveries {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.deliver(ctx, delivery)
+			<-slots
+		}()
+	}
+	wg.Wait()
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery *model.WebhookDelivery) {
+	logger := d.logger.With("webhook", delivery.WebhookID, "delivery", delivery.ID, "event", delivery.Event)
+	webhook, err := d.webhooks.Get(ctx, delivery.WebhookID)
+	if err != nil {
+		logger.Error("loading webhook failed", "error", err)
+		return
+	}
+	delivery.Attempts++
+	delivery.ResponseStatus, err = d.send(ctx, webhook, delivery)
+	result := "retry"
+	switch {
+	case err == nil:
+		result = model.DeliverySucceeded
+		delivery.Status = model.DeliverySucceeded
+		delivery.DeliveredAt = model.FNow()
+		delivery.NextAttemptAt = nil
+		delivery.Error = ""
+	case delivery.Attempts >= d.config.MaxAttempts:
+		result = model.DeliveryFailed
+		delivery.Status = model.DeliveryFailed
+		delivery.NextAttemptAt = nil
+		delivery.Error = err.Error()
+	default:
+		next := time.Now().Add(backoff(d.config.Backoff, delivery.Attempts))
+		delivery.NextAttemptAt = &next
+		delivery.Error = err.Error()
+	}
+	metrics.WebhookDeliveries.WithLabelValues(delivery.Event, result).Inc()
+	if err := d.deliveries.Save(ctx, delivery); err != nil {
+		logger.Error("saving webhook delivery failed", "error", err)
+		return
+	}
+	if result != model.DeliverySucceeded {
+		logger.Warn("webhook delivery failed", "attempts", delivery.Attempts, "status", delivery.Status, "error", delivery.Error)
+	}
+}
+
+func (d *Dispatcher) send(ctx context.Context, webhook *model.Webhook, delivery *model.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.config.Timeout)
+	defer cancel()
+	payload := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "member-webhook")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, time.Now(), payload))
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("endpoint answered %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
@@ -0,0 +1,23 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	for _, test := range []struct {
+		attempts int
+		delay    time.Duration
+	}{
+		{1, time.Minute},
+		{3, 4 * time.Minute},
+		{7, maxBackoff},
+		{64, maxBackoff},
+		{1 << 30, maxBackoff},
+	} {
+		if delay := backoff(time.Minute, test.attempts); delay != test.delay {
+			t.Errorf("backoff after %d attempts = %s, want %s", test.attempts, delay, test.delay)
+		}
+	}
+}